@@ -0,0 +1,21 @@
+//go:build embedfrontend
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Run `npm run build` before building with -tags embedfrontend so ./build exists.
+//
+//go:embed all:build
+var embeddedBuild embed.FS
+
+func init() {
+	sub, err := fs.Sub(embeddedBuild, "build")
+	if err != nil {
+		panic(err)
+	}
+	embeddedFrontend = sub
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+var printConfig = flag.Bool("print-config", false, "print every setting with where its value came from, then exit")
+
+const envPrefix = "TEMPCHAT_"
+
+// secretFlags are masked by -print-config.
+var secretFlags = map[string]bool{"rooms-token": true, "daily-report-webhook": true}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// parseFlags applies TEMPCHAT_* environment variables and then args to fs,
+// so a flag beats the environment, which beats the default. It returns where
+// each setting came from.
+func parseFlags(fs *flag.FlagSet, args []string) map[string]string {
+	sources := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		sources[f.Name] = "default"
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if err := f.Value.Set(value); err != nil {
+			log.Fatalf("%s: invalid value %q for -%s: %v", envName(f.Name), value, f.Name, err)
+		}
+		sources[f.Name] = "env " + envName(f.Name)
+	})
+	fs.Parse(args)
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = "flag"
+	})
+	return sources
+}
+
+func writeConfig(sources map[string]string) {
+	var names []string
+	flag.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	sort.Strings(names)
+	for _, name := range names {
+		value := flag.Lookup(name).Value.String()
+		if secretFlags[name] && value != "" {
+			value = "(set)"
+		}
+		fmt.Printf("%s=%s\t# %s\n", name, value, sources[name])
+	}
+}
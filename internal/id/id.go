@@ -0,0 +1,118 @@
+// Package id mints ULIDs: 128-bit identifiers made of a 48-bit millisecond
+// timestamp and 80 bits of crypto/rand entropy, rendered as 26 characters of
+// Crockford base32. IDs from one Generator sort in creation order, including
+// several minted within the same millisecond.
+package id
+
+import (
+	"crypto/rand"
+	"errors"
+	"sync"
+	"time"
+)
+
+const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ID is a ULID. The zero value is not a valid id.
+type ID [16]byte
+
+// ErrOverflow is returned when more ids are requested within one millisecond
+// than the entropy can count through.
+var ErrOverflow = errors.New("id: monotonic entropy overflow")
+
+// String returns the canonical 26-character encoding.
+func (id ID) String() string {
+	var out [26]byte
+	// 128 bits encode into 26 base32 digits with 2 leading zero bits.
+	var acc uint64
+	bits := 2
+	pos := 0
+	for _, b := range id {
+		acc = acc<<8 | uint64(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[pos] = alphabet[(acc>>uint(bits))&0x1f]
+			pos++
+		}
+	}
+	return string(out[:])
+}
+
+// MarshalText implements encoding.TextMarshaler so ids encode as strings.
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// Time returns the millisecond timestamp embedded in the id.
+func (id ID) Time() time.Time {
+	var ms int64
+	for _, b := range id[:6] {
+		ms = ms<<8 | int64(b)
+	}
+	return time.UnixMilli(ms)
+}
+
+// Generator mints monotonically increasing ids. It is safe for concurrent use.
+type Generator struct {
+	mu     sync.Mutex
+	last   ID
+	lastMs int64
+	now    func() time.Time
+}
+
+// NewGenerator returns a Generator reading the wall clock.
+func NewGenerator() *Generator {
+	return &Generator{now: time.Now}
+}
+
+// New returns the next id. Within one millisecond, or if the clock steps
+// backwards, the previous id's entropy is incremented instead of redrawn so
+// ids stay strictly ordered.
+func (g *Generator) New() (ID, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := g.now().UnixMilli()
+	if ms < 0 || ms >= 1<<48 {
+		return ID{}, errors.New("id: timestamp out of range")
+	}
+
+	var next ID
+	if g.last != (ID{}) && ms <= g.lastMs {
+		next = g.last
+		for i := 15; ; i-- {
+			if i < 6 {
+				return ID{}, ErrOverflow
+			}
+			next[i]++
+			if next[i] != 0 {
+				break
+			}
+		}
+	} else {
+		t := ms
+		for i := 5; i >= 0; i-- {
+			next[i] = byte(t)
+			t >>= 8
+		}
+		if _, err := rand.Read(next[6:]); err != nil {
+			return ID{}, err
+		}
+		g.lastMs = ms
+	}
+	g.last = next
+	return next, nil
+}
+
+var defaultGenerator = NewGenerator()
+
+// New returns an id from the package-level Generator, panicking only if the
+// system entropy source fails or a millisecond's ids are exhausted.
+func New() ID {
+	id, err := defaultGenerator.New()
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"chat/server"
+)
+
+var addr = flag.String("addr", ":8080", "http service address")
+var shutdownGrace = flag.Duration("shutdown-grace", 10*time.Second, "how long SIGINT or SIGTERM waits for clients to be told and disconnected before exiting")
+
+// embeddedFrontend is set by embed_frontend.go when built with -tags embedfrontend.
+var embeddedFrontend fs.FS
+
+func main() {
+	opts := server.DefaultOptions()
+	opts.RegisterFlags(flag.CommandLine)
+	sources := parseFlags(flag.CommandLine, os.Args[1:])
+	if *printConfig {
+		writeConfig(sources)
+		return
+	}
+	opts.Frontend = embeddedFrontend
+	hub, err := server.NewHub(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.RoomsConfig != "" {
+		go reloadOnHangup(hub)
+	}
+	ctx, stopHub := context.WithCancel(context.Background())
+	go hub.Run(ctx)
+
+	mux := http.NewServeMux()
+	hub.Register(mux)
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+	log.Printf("Server starting on %s", *addr)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case sig := <-stop:
+		log.Printf("Received %v, shutting down", sig)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownGrace)
+	defer cancel()
+	hub.Drain(shutdownCtx)
+	stopHub()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+	log.Printf("Server stopped")
+}
+
+func reloadOnHangup(hub *server.Hub) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := hub.ReloadRoomsConfig(); err != nil {
+			log.Printf("Rooms config reload failed, keeping current rooms: %v", err)
+		}
+	}
+}
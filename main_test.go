@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"chat/server"
+
+	"github.com/gorilla/websocket"
+)
+
+func testFlags() (*flag.FlagSet, *server.Options) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts := server.DefaultOptions()
+	opts.RegisterFlags(fs)
+	return fs, &opts
+}
+
+func TestFlagBeatsEnvBeatsDefault(t *testing.T) {
+	t.Setenv("TEMPCHAT_MSG_BURST", "40")
+	t.Setenv("TEMPCHAT_MAX_REMINDERS", "7")
+	fs, opts := testFlags()
+	defaults := server.DefaultOptions()
+	sources := parseFlags(fs, []string{"-msg-burst", "60"})
+
+	if opts.MsgBurst != 60 || sources["msg-burst"] != "flag" {
+		t.Errorf("msg-burst = %d from %s, want 60 from the flag", opts.MsgBurst, sources["msg-burst"])
+	}
+	if opts.MaxReminders != 7 || sources["max-reminders"] != "env TEMPCHAT_MAX_REMINDERS" {
+		t.Errorf("max-reminders = %d from %s, want 7 from the environment", opts.MaxReminders, sources["max-reminders"])
+	}
+	if opts.SendBuffer != defaults.SendBuffer || sources["send-buffer"] != "default" {
+		t.Errorf("send-buffer = %d from %s, want the default", opts.SendBuffer, sources["send-buffer"])
+	}
+}
+
+func TestEveryFlagHasAnEnvVar(t *testing.T) {
+	fs, _ := testFlags()
+	fs.VisitAll(func(f *flag.Flag) {
+		if name := envName(f.Name); !strings.HasPrefix(name, envPrefix) || strings.ContainsAny(name, "-.") {
+			t.Errorf("-%s maps to %q", f.Name, name)
+		}
+	})
+	if got := envName("rooms-config-close-removed"); got != "TEMPCHAT_ROOMS_CONFIG_CLOSE_REMOVED" {
+		t.Errorf("envName = %q", got)
+	}
+}
+
+// The server under TestSIGTERMDrains runs in a copy of the test binary.
+func TestMain(m *testing.M) {
+	if os.Getenv("TEMPCHAT_TEST_MAIN") == "1" {
+		os.Args = append([]string{os.Args[0]}, strings.Fields(os.Getenv("TEMPCHAT_TEST_ARGS"))...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestSIGTERMDrains(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts the server in a subprocess")
+	}
+	addr := freeAddr(t)
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "TEMPCHAT_TEST_MAIN=1", "TEMPCHAT_TEST_ARGS=-addr "+addr+" -no-static")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill() })
+
+	var conn *websocket.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var err error
+		conn, _, err = websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/ws?room=lobby&username=alice", addr), nil)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not come up: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	defer conn.Close()
+	conn.ReadMessage() // hello
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Fatalf("connection ended with %v, want a going-away close", err)
+		}
+		break
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Fatalf("server exited with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server still running after SIGTERM")
+	}
+}
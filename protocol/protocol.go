@@ -0,0 +1,215 @@
+// Package protocol defines the frames exchanged on the chat server's /ws
+// endpoint. The server and any Go client share it so they cannot disagree
+// about the wire format.
+package protocol
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Every frame the server sends on /ws is one JSON-encoded Envelope:
+//
+//	{"type":"chat","sender":"alice","senderId":"k2v7q9xa","room":"general",
+//	 "timestamp":"2026-01-02T15:04:05.123Z","body":"hello"}
+//
+// Type is one of the Event* constants below. Sender and SenderID are the
+// member's display name and public id; they are omitted on system events.
+// Chat events posted over HTTP, with an API key or /rooms/send, are marked
+// bot and carry no SenderID: their Sender is the key's or the request's
+// name, which a member may share.
+// Join and leave events also carry the room's member count after the change,
+// and are marked quiet while a mass disconnect is being summarized: clients
+// should update their member list but not show a line for them.
+// The hello event is sent only to the joining client, first, and names the
+// client itself plus its ConnectionID for correlating error reports; its
+// Members lists everyone in the room, the client included. When the join
+// made the client owner by creating or reserving the room, the hello also
+// carries OwnerCode: joining again with ?owner=CODE, after a disconnect or
+// a server restart, makes the client owner again.
+// A presence event stands for several join and leave events that happened
+// close together: Changes lists them in order, UserCount is the count after
+// the last, and Body describes the ones that are not quiet.
+// The hello and limits events carry the room's rate limit for each
+// connection; limits is broadcast when the owner changes it.
+// The api_key event answers a room owner's key management frames.
+// A whoami event answers the client's whoami frame, to that client alone:
+// Whoami holds what the server knows about the connection and Body says
+// the same in words.
+// A dm event is a private message: it goes only to the member named by To
+// and ToID, and back to its sender.
+// Chat events sent to a whole room carry Seq, which the server counts up by
+// one per room, so a gap means frames were missed; the hello event carries
+// the latest. A client rejoining with ?since=SEQ first gets the newer chat
+// events the server still holds. A room created again under an old name
+// counts from 1. A client that also passes ?history=windowed gets them as
+// history events instead: History holds the newest of them, at most about
+// 32KB, oldest first, and More says older ones remain, which a history_more
+// frame asks for.
+//
+// Decoding ignores fields it does not know, so clients built against an
+// older version of this package keep working as fields are added.
+type Envelope struct {
+	Type         string           `json:"type"`
+	Sender       string           `json:"sender,omitempty"`
+	SenderID     string           `json:"senderId,omitempty"`
+	Bot          bool             `json:"bot,omitempty"`
+	Room         string           `json:"room"`
+	Timestamp    time.Time        `json:"timestamp"`
+	Body         string           `json:"body"`
+	UserCount    *int             `json:"userCount,omitempty"`
+	Quiet        bool             `json:"quiet,omitempty"`
+	ConnectionID string           `json:"connectionId,omitempty"`
+	APIKeys      []APIKeyInfo     `json:"apiKeys,omitempty"`
+	Changes      []PresenceChange `json:"changes,omitempty"`
+	Limits       *Limits          `json:"limits,omitempty"`
+	Members      []Member         `json:"members,omitempty"`
+	To           string           `json:"to,omitempty"`
+	ToID         string           `json:"toId,omitempty"`
+	Seq          uint64           `json:"seq,omitempty"`
+	Whoami       *Whoami          `json:"whoami,omitempty"`
+	History      []Envelope       `json:"history,omitempty"`
+	More         bool             `json:"more,omitempty"`
+	OwnerCode    string           `json:"ownerCode,omitempty"`
+}
+
+// Whoami describes a connection to itself. Rooms lists every room the
+// connection is in, the first it joined first; Name, ID and Roles, owner
+// and operator as they apply, are its own in the event's Room. Available is how many frames it could send right now under
+// Limits, and Strikes how many rate limit warnings count against it.
+type Whoami struct {
+	Name         string    `json:"name"`
+	ID           string    `json:"id"`
+	ConnectionID string    `json:"connectionId"`
+	Rooms        []string  `json:"rooms"`
+	Roles        []string  `json:"roles,omitempty"`
+	ConnectedAt  time.Time `json:"connectedAt"`
+	MessagesSent uint64    `json:"messagesSent"`
+	Limits       Limits    `json:"limits"`
+	Available    int       `json:"available"`
+	Strikes      int       `json:"strikes"`
+	Echo         bool      `json:"echo,omitempty"`
+}
+
+// PresenceChange is one join or leave inside a presence event.
+type PresenceChange struct {
+	Type     string `json:"type"`
+	Sender   string `json:"sender"`
+	SenderID string `json:"senderId"`
+	Quiet    bool   `json:"quiet,omitempty"`
+}
+
+// Member is one entry of a room's roster. ID is the member's public id.
+type Member struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// Limits is the per-connection rate limit a room applies.
+type Limits struct {
+	Profile           string  `json:"profile"`
+	MessagesPerSecond float64 `json:"messagesPerSecond"`
+	MessageBurst      int     `json:"messageBurst"`
+}
+
+// APIKeyInfo describes a room API key; it never includes the secret.
+type APIKeyInfo struct {
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+const (
+	EventChat     = "chat"
+	EventSystem   = "system"
+	EventJoin     = "join"
+	EventLeave    = "leave"
+	EventHello    = "hello"
+	EventAPIKey   = "api_key"
+	EventPresence = "presence"
+	EventLimits   = "limits"
+	EventDM       = "dm"
+	EventWhoami   = "whoami"
+	EventHistory  = "history"
+)
+
+// Encode returns env as JSON.
+func (env Envelope) Encode() []byte {
+	data, err := json.Marshal(env)
+	if err != nil {
+		// Envelope holds only strings, numbers, slices and a time; this
+		// cannot happen.
+		log.Printf("Failed to encode %s event: %v", env.Type, err)
+	}
+	return data
+}
+
+// Clients send either a JSON object such as {"type":"chat","body":"hello"}
+// or plain text, which older clients do and which is treated as the body of
+// a chat message. Any other JSON object is read the same way, so that a
+// user typing something that happens to look like JSON still gets it sent.
+// A dm frame sends Body privately to the member named To. Room owners also
+// send create_api_key, list_api_keys and revoke_api_key frames, which use
+// Name and Scopes. A whoami frame asks for the client's own whoami event. A
+// history_more frame asks a windowed client's next history event, of the
+// chat events numbered below Before.
+//
+// One connection can be in several rooms. A join frame adds the room named
+// by Room, with Password if it has one, and is answered with that room's
+// hello event; a leave frame leaves it, and leaving the last room closes the
+// connection. Every other frame goes to the room named by Room, or without
+// one to the connection's first room: the one it connected to, unless it
+// has left it since. Every event names the room it belongs to.
+type Inbound struct {
+	Type     string   `json:"type"`
+	Room     string   `json:"room,omitempty"`
+	Body     string   `json:"body,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Password string   `json:"password,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	Before   uint64   `json:"before,omitempty"`
+}
+
+const (
+	TypeCreateAPIKey = "create_api_key"
+	TypeListAPIKeys  = "list_api_keys"
+	TypeRevokeAPIKey = "revoke_api_key"
+	TypeWhoami       = EventWhoami
+	TypeHistoryMore  = "history_more"
+	TypeJoin         = EventJoin
+	TypeLeave        = EventLeave
+)
+
+// inboundTypes are the frame types the server accepts.
+var inboundTypes = map[string]bool{
+	EventChat:        true,
+	EventDM:          true,
+	TypeCreateAPIKey: true,
+	TypeListAPIKeys:  true,
+	TypeRevokeAPIKey: true,
+	TypeWhoami:       true,
+	TypeHistoryMore:  true,
+	TypeJoin:         true,
+	TypeLeave:        true,
+}
+
+// ParseInbound returns the frame a client sent. ok is false for a JSON frame
+// with a type the server does not understand.
+func ParseInbound(data []byte) (frame Inbound, ok bool) {
+	var decoded Inbound
+	if json.Unmarshal(data, &decoded) != nil || decoded.Type == "" {
+		return Inbound{Type: EventChat, Body: string(data)}, true
+	}
+	if !inboundTypes[decoded.Type] {
+		return decoded, false
+	}
+	return decoded, true
+}
+
+// Encode returns frame as JSON.
+func (frame Inbound) Encode() []byte {
+	data, _ := json.Marshal(frame)
+	return data
+}
@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2026, 1, 2, 15, 4, 5, 123e6, time.UTC)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	count := 3
+	limits := Limits{Profile: "standard", MessagesPerSecond: 5, MessageBurst: 10}
+	env := Envelope{
+		Type: EventChat, Sender: "alice", SenderID: "k2v7q9xa", Bot: true, Room: "general",
+		Timestamp: testTime, Body: "hello", UserCount: &count, Quiet: true, ConnectionID: "c0nn",
+		APIKeys: []APIKeyInfo{{Name: "deploys", Scopes: []string{"post_message"}, Created: testTime}},
+		Changes: []PresenceChange{{Type: EventJoin, Sender: "bob", SenderID: "b0b", Quiet: true}},
+		Limits:  &limits,
+		Members: []Member{{Name: "alice", ID: "k2v7q9xa"}},
+		To:      "bob", ToID: "b0b", Seq: 42,
+		Whoami:  &Whoami{Name: "alice", ID: "k2v7q9xa", ConnectionID: "c0nn", Roles: []string{"owner"}, ConnectedAt: testTime, MessagesSent: 7, Limits: limits, Available: 4, Strikes: 1, Echo: true},
+		History: []Envelope{{Type: EventChat, Room: "general", Timestamp: testTime, Body: "earlier", Seq: 41}},
+		More:    true,
+	}
+	var got Envelope
+	if err := json.Unmarshal(env.Encode(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, env) {
+		t.Fatalf("round trip changed the envelope:\n got %+v\nwant %+v", got, env)
+	}
+}
+
+func TestEnvelopeOmitsEmptyFields(t *testing.T) {
+	env := Envelope{Type: EventSystem, Room: "general", Timestamp: testTime, Body: "hi"}
+	want := `{"type":"system","room":"general","timestamp":"2026-01-02T15:04:05.123Z","body":"hi"}`
+	if got := string(env.Encode()); got != want {
+		t.Fatalf("encoded %s\nwant    %s", got, want)
+	}
+}
+
+func TestEnvelopeIgnoresUnknownFields(t *testing.T) {
+	data := `{"type":"chat","sender":"alice","senderId":"k2v7q9xa","room":"general",
+	 "timestamp":"2026-01-02T15:04:05.123Z","body":"hello",
+	 "reactions":[{"emoji":"+1"}],"edited":true}`
+	var env Envelope
+	if err := json.Unmarshal([]byte(data), &env); err != nil {
+		t.Fatalf("decoding a newer envelope failed: %v", err)
+	}
+	if env.Type != EventChat || env.Sender != "alice" || env.Body != "hello" || !env.Timestamp.Equal(testTime) {
+		t.Fatalf("decoded %+v", env)
+	}
+}
+
+func TestInboundRoundTrip(t *testing.T) {
+	frame := Inbound{Type: TypeCreateAPIKey, Room: "general", Body: "b", To: "bob", Name: "deploys", Password: "pw", Scopes: []string{"post_message"}, Before: 9}
+	got, ok := ParseInbound(frame.Encode())
+	if !ok || !reflect.DeepEqual(got, frame) {
+		t.Fatalf("ParseInbound = %+v, %v; want %+v", got, ok, frame)
+	}
+}
+
+func TestParseInbound(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want Inbound
+		ok   bool
+	}{
+		{"hello", Inbound{Type: EventChat, Body: "hello"}, true},
+		{`{"type":"chat","body":"hi","room":"side"}`, Inbound{Type: EventChat, Body: "hi", Room: "side"}, true},
+		{`{"type":"dm","to":"bob","body":"psst"}`, Inbound{Type: EventDM, To: "bob", Body: "psst"}, true},
+		{`{"type":"join","room":"side","password":"pw"}`, Inbound{Type: TypeJoin, Room: "side", Password: "pw"}, true},
+		{`{"type":"history_more","before":40}`, Inbound{Type: TypeHistoryMore, Before: 40}, true},
+		// JSON that is not a frame is a chat message as typed.
+		{`{"body":"no type"}`, Inbound{Type: EventChat, Body: `{"body":"no type"}`}, true},
+		{`{not json`, Inbound{Type: EventChat, Body: `{not json`}, true},
+		{`["a"]`, Inbound{Type: EventChat, Body: `["a"]`}, true},
+		// Unknown fields are ignored, unknown types refused.
+		{`{"type":"chat","body":"hi","flair":"x"}`, Inbound{Type: EventChat, Body: "hi"}, true},
+		{`{"type":"poll","body":"?"}`, Inbound{Type: "poll", Body: "?"}, false},
+	} {
+		got, ok := ParseInbound([]byte(tc.data))
+		if ok != tc.ok || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseInbound(%s) = %+v, %v; want %+v, %v", tc.data, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// checkRoomsToken reports whether r may use the room listing endpoints,
+// writing the error response when it may not.
+func (h *Hub) checkRoomsToken(w http.ResponseWriter, r *http.Request) bool {
+	if h.opts.RoomsToken == "" {
+		if !h.opts.RoomsOpen {
+			http.Error(w, "Room listing is disabled", http.StatusNotFound)
+			return false
+		}
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.opts.RoomsToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// checkOrigin is the upgrader's origin policy. Requests without an Origin
+// header come from non-browser clients, which could forge one anyway.
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	return originAllowed(origin, h.opts.AllowedOrigins)
+}
+
+// originAllowed matches origin against a comma-separated allow list by
+// scheme and host, including any port, ignoring case.
+func originAllowed(origin, allowList string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	for _, entry := range strings.Split(allowList, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "*" {
+			return true
+		}
+		allowed, err := url.Parse(entry)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(allowed.Scheme, u.Scheme) && strings.EqualFold(allowed.Host, u.Host) {
+			return true
+		}
+	}
+	return false
+}
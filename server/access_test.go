@@ -0,0 +1,117 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	list := "https://chat.example.com, http://localhost:5173"
+	for origin, want := range map[string]bool{
+		"https://chat.example.com":     true,
+		"HTTPS://Chat.Example.com":     true,
+		"http://localhost:5173":        true,
+		"http://chat.example.com":      false,
+		"https://chat.example.com:444": false,
+		"https://evil.example.com":     false,
+		"http://localhost":             false,
+		"null":                         false,
+	} {
+		if got := originAllowed(origin, list); got != want {
+			t.Errorf("originAllowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+	if !originAllowed("https://anything.example", "*") {
+		t.Error("* did not allow every origin")
+	}
+}
+
+func (s *testServer) dialOrigin(t *testing.T, origin string) int {
+	t.Helper()
+	header := http.Header{"Origin": {origin}}
+	conn, resp, err := websocket.DefaultDialer.Dial(s.wsURL("room=lobby&username=alice"), header)
+	if err == nil {
+		conn.Close()
+		return http.StatusSwitchingProtocols
+	}
+	if resp == nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestWebSocketOriginPolicy(t *testing.T) {
+	s := newTestServer(t, func(o *Options) { o.AllowedOrigins = "https://chat.example.com" })
+	if status := s.dialOrigin(t, "https://chat.example.com"); status != http.StatusSwitchingProtocols {
+		t.Fatalf("allowed origin: status %d", status)
+	}
+	if status := s.dialOrigin(t, "https://evil.example.com"); status != http.StatusForbidden {
+		t.Fatalf("blocked origin: status %d, want 403", status)
+	}
+}
+
+func TestRoomsToken(t *testing.T) {
+	s := newTestServer(t, withRoomsToken)
+	get := func(query string) int {
+		t.Helper()
+		resp, err := http.Get(s.srv.URL + "/rooms" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := get("?token=" + testRoomsToken); status != http.StatusOK {
+		t.Fatalf("correct token: status %d", status)
+	}
+	if status := get("?token=wrong"); status != http.StatusUnauthorized {
+		t.Fatalf("wrong token: status %d, want 401", status)
+	}
+	if status := get(""); status != http.StatusUnauthorized {
+		t.Fatalf("no token: status %d, want 401", status)
+	}
+}
+
+func TestRoomsWithoutToken(t *testing.T) {
+	for _, open := range []bool{true, false} {
+		opts := DefaultOptions()
+		opts.RoomsOpen = open
+		h, err := NewHub(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		h.HandleRooms(rec, httptest.NewRequest("GET", "/rooms", nil))
+		want := http.StatusNotFound
+		if open {
+			want = http.StatusOK
+		}
+		if rec.Code != want {
+			t.Errorf("-rooms-open=%v: status %d, want %d", open, rec.Code, want)
+		}
+	}
+}
+
+func TestRoomsPreflight(t *testing.T) {
+	s := newTestServer(t, withRoomsToken)
+	req, _ := http.NewRequest("OPTIONS", s.srv.URL+"/rooms", nil)
+	req.Header.Set("Origin", "https://chat.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("preflight without a token: status %d, want 200", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Methods"); got == "" {
+		t.Fatal("no Access-Control-Allow-Methods")
+	}
+}
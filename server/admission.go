@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// admissionController smooths the burst of reconnects after a restart. Work
+// that is expensive per connection, such as bcrypt, runs only after admit.
+type admissionController struct {
+	clock    clock
+	mu       sync.Mutex
+	bucket   tokenBucket
+	maxWait  time.Duration
+	maxQueue int
+	waiting  int
+	admitted uint64
+	shed     uint64
+}
+
+func newAdmissionController(o *Options, c clock) *admissionController {
+	return &admissionController{clock: c, bucket: newTokenBucket(o.AdmitRate, o.AdmitBurst), maxWait: o.AdmitWait, maxQueue: o.AdmitQueue}
+}
+
+// admit blocks until the connection may proceed, or reports false at once if
+// it would have to wait longer than -admit-wait or the queue is full.
+func (a *admissionController) admit(r *http.Request) bool {
+	a.mu.Lock()
+	wait, ok := a.bucket.reserve(a.clock.Now(), a.maxWait)
+	if ok && wait > 0 && a.waiting >= a.maxQueue {
+		a.bucket.tokens++
+		ok = false
+	}
+	if !ok {
+		a.shed++
+		a.mu.Unlock()
+		return false
+	}
+	a.admitted++
+	if wait <= 0 {
+		a.mu.Unlock()
+		return true
+	}
+	a.waiting++
+	a.mu.Unlock()
+
+	select {
+	case <-a.clock.After(wait):
+	case <-r.Context().Done():
+	}
+	a.mu.Lock()
+	a.waiting--
+	a.mu.Unlock()
+	return r.Context().Err() == nil
+}
+
+// shedResponse turns a connection away with a jittered Retry-After so the
+// clients behind a mass reconnect do not all come back in the same second.
+func shedResponse(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(1+mathrand.IntN(5)))
+	http.Error(w, "Server busy, retry shortly", http.StatusServiceUnavailable)
+}
+
+type admissionStats struct {
+	Waiting  int                   `json:"waiting"`
+	Admitted uint64                `json:"admitted"`
+	Shed     uint64                `json:"shed"`
+	Classes  map[string]classUsage `json:"classes"`
+}
+
+func (a *admissionController) stats() admissionStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return admissionStats{Waiting: a.waiting, Admitted: a.admitted, Shed: a.shed}
+}
+
+func (h *Hub) handleAdmission(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	stats := h.admission.stats()
+	stats.Classes = h.budget.stats()
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestAdmission is an admission controller on a fake clock that admits
+// rate connections a second, with the given burst, wait and queue.
+func newTestAdmission(rate float64, burst int, wait time.Duration, queue int) (*admissionController, *fakeClock) {
+	clock := newFakeClock()
+	opts := DefaultOptions()
+	opts.AdmitRate, opts.AdmitBurst, opts.AdmitWait, opts.AdmitQueue = rate, burst, wait, queue
+	return newAdmissionController(&opts, clock), clock
+}
+
+// admitAsync runs admit for a new request and returns where its answer
+// will arrive.
+func admitAsync(ctx context.Context, a *admissionController) <-chan bool {
+	done := make(chan bool, 1)
+	r := httptest.NewRequest("GET", "/ws", nil).WithContext(ctx)
+	go func() { done <- a.admit(r) }()
+	return done
+}
+
+// awaitAdmit moves clock on until the answer on done arrives.
+func awaitAdmit(t *testing.T, clock *fakeClock, done <-chan bool) bool {
+	t.Helper()
+	var admitted bool
+	waitFor(t, "admit to return", func() bool {
+		clock.Advance(10 * time.Millisecond)
+		select {
+		case admitted = <-done:
+			return true
+		default:
+			return false
+		}
+	})
+	return admitted
+}
+
+func TestAdmissionQueuesWithinWait(t *testing.T) {
+	a, clock := newTestAdmission(10, 1, time.Second, 5)
+	if !<-admitAsync(context.Background(), a) {
+		t.Fatal("first connection not admitted from the burst")
+	}
+	done := admitAsync(context.Background(), a)
+	waitFor(t, "the connection to queue", func() bool { return a.stats().Waiting == 1 })
+	select {
+	case <-done:
+		t.Fatal("queued connection admitted before its token was due")
+	default:
+	}
+	if !awaitAdmit(t, clock, done) {
+		t.Fatal("queued connection shed")
+	}
+	if stats := a.stats(); stats.Waiting != 0 || stats.Admitted != 2 || stats.Shed != 0 {
+		t.Fatalf("stats %+v, want 2 admitted and none waiting or shed", stats)
+	}
+}
+
+func TestAdmissionShedsPastWait(t *testing.T) {
+	a, _ := newTestAdmission(1, 1, 500*time.Millisecond, 5)
+	<-admitAsync(context.Background(), a)
+	if <-admitAsync(context.Background(), a) {
+		t.Fatal("admitted a connection whose token is a second away with -admit-wait 500ms")
+	}
+	if stats := a.stats(); stats.Admitted != 1 || stats.Shed != 1 {
+		t.Fatalf("stats %+v, want 1 admitted and 1 shed", stats)
+	}
+}
+
+func TestAdmissionFullQueueRestoresToken(t *testing.T) {
+	a, clock := newTestAdmission(10, 1, time.Second, 1)
+	<-admitAsync(context.Background(), a)
+	queued := admitAsync(context.Background(), a)
+	waitFor(t, "the connection to queue", func() bool { return a.stats().Waiting == 1 })
+	a.mu.Lock()
+	before := a.bucket.tokens
+	a.mu.Unlock()
+	if <-admitAsync(context.Background(), a) {
+		t.Fatal("admitted past a full queue")
+	}
+	a.mu.Lock()
+	after := a.bucket.tokens
+	a.mu.Unlock()
+	if after != before {
+		t.Fatalf("shedding left %v tokens, want %v back", after, before)
+	}
+	if !awaitAdmit(t, clock, queued) {
+		t.Fatal("queued connection shed")
+	}
+}
+
+func TestAdmissionCancelledWhileQueued(t *testing.T) {
+	a, _ := newTestAdmission(10, 1, time.Second, 5)
+	<-admitAsync(context.Background(), a)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := admitAsync(ctx, a)
+	waitFor(t, "the connection to queue", func() bool { return a.stats().Waiting == 1 })
+	cancel()
+	if <-done {
+		t.Fatal("admitted a connection that went away while queued")
+	}
+	if a.stats().Waiting != 0 {
+		t.Fatal("cancelled connection still counted as waiting")
+	}
+}
+
+// TestAdmissionReconnectStorm is 5000 clients reconnecting at once to a
+// server on the default limits: the burst gets in, -admit-wait worth of
+// -admit-rate queues, and the rest are told to retry.
+func TestAdmissionReconnectStorm(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts 5000 goroutines")
+	}
+	const clients = 5000
+	opts := DefaultOptions()
+	a, clock := newTestAdmission(opts.AdmitRate, opts.AdmitBurst, opts.AdmitWait, opts.AdmitQueue)
+	results := make([]<-chan bool, clients)
+	var start sync.WaitGroup
+	start.Add(1)
+	for i := range results {
+		done := make(chan bool, 1)
+		results[i] = done
+		go func() {
+			start.Wait()
+			done <- a.admit(httptest.NewRequest("GET", "/ws", nil))
+		}()
+	}
+	start.Done()
+	queued := int(opts.AdmitRate * opts.AdmitWait.Seconds())
+	waitFor(t, "every client to be admitted, queued or shed", func() bool {
+		stats := a.stats()
+		return stats.Admitted+stats.Shed == clients && stats.Waiting == queued
+	})
+	waitFor(t, "the queue to empty", func() bool {
+		clock.Advance(100 * time.Millisecond)
+		return a.stats().Waiting == 0
+	})
+	admitted := 0
+	for _, done := range results {
+		if <-done {
+			admitted++
+		}
+	}
+	if want := opts.AdmitBurst + queued; admitted != want {
+		t.Fatalf("%d of %d admitted, want the burst of %d plus %d queued", admitted, clients, opts.AdmitBurst, queued)
+	}
+	if stats := a.stats(); stats.Waiting != 0 || stats.Shed != uint64(clients-admitted) {
+		t.Fatalf("stats %+v after the storm, want none waiting and %d shed", stats, clients-admitted)
+	}
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"chat/protocol"
+)
+
+const (
+	apiKeyWindow      = time.Minute
+	maxAPIKeysPerRoom = 10
+	maxAPIKeyName     = 32
+)
+
+// apiKey lets a script act on one room through the REST routes below. Only
+// the sha256 of the secret is kept, as the key of Room.apiKeys, and only the
+// name is ever logged. Fields are guarded by the room's mu.
+type apiKey struct {
+	name    string
+	scopes  []string
+	created time.Time
+	uses    int
+}
+
+func (k *apiKey) info() protocol.APIKeyInfo {
+	return protocol.APIKeyInfo{Name: k.name, Scopes: k.scopes, Created: k.created}
+}
+
+// roomRoute is a REST endpoint acting on the room named by its {name}
+// wildcard. Every one is served through roomScoped, so it cannot be added
+// without declaring the scope a key needs to call it.
+type roomRoute struct {
+	pattern string
+	scope   string
+	handler func(h *Hub, w http.ResponseWriter, r *http.Request, room *Room, key *apiKey)
+}
+
+var roomRoutes = []roomRoute{
+	{"POST /rooms/{name}/messages", "post_message", (*Hub).handleRoomPost},
+	{"GET /rooms/{name}/stats", "read_stats", (*Hub).handleRoomStats},
+	{"POST /rooms/{name}/invites", "invite", (*Hub).handleRoomInvite},
+}
+
+func knownScope(scope string) bool {
+	for _, route := range roomRoutes {
+		if route.scope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) registerRoomRoutes(mux *http.ServeMux) {
+	for _, route := range roomRoutes {
+		mux.Handle(route.pattern, h.roomScoped(route.scope, route.handler))
+	}
+}
+
+// roomScoped authenticates the bearer key against the room, enforces its
+// scope and rate limit, and records the use.
+func (h *Hub) roomScoped(scope string, next func(*Hub, http.ResponseWriter, *http.Request, *Room, *apiKey)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		room := h.getRoom(r.PathValue("name"))
+		if room == nil {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || secret == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		hash := sha256.Sum256([]byte(secret))
+
+		room.mu.Lock()
+		key := room.apiKeys[hash]
+		status := http.StatusOK
+		switch {
+		case key == nil:
+			status = http.StatusUnauthorized
+		case !slices.Contains(key.scopes, scope):
+			status = http.StatusForbidden
+		case key.uses >= h.opts.APIKeyRequests:
+			status = http.StatusTooManyRequests
+		default:
+			if key.uses == 0 {
+				h.janitor.schedule("api-key-window", apiKeyWindow, func() {
+					room.mu.Lock()
+					key.uses = 0
+					room.mu.Unlock()
+				})
+			}
+			key.uses++
+		}
+		room.mu.Unlock()
+
+		if key == nil {
+			http.Error(w, "Unauthorized", status)
+			return
+		}
+		log.Printf("room=%q api-key=%q scope=%s %s %s status=%d", room.name, key.name, scope, r.Method, r.URL.Path, status)
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next(h, w, r, room, key)
+	})
+}
+
+// handleRoomPost broadcasts {"body": "..."} as a chat message from the key.
+// API messages carry the key's name as sender and no sender id.
+func (h *Hub) handleRoomPost(w http.ResponseWriter, r *http.Request, room *Room, key *apiKey) {
+	var post struct {
+		Body string `json:"body"`
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(h.opts.MaxMessageSize)+4096))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&post); err != nil {
+		http.Error(w, "Invalid message", http.StatusBadRequest)
+		return
+	}
+	// Posts are held to the rules chat frames are.
+	body := sanitizeText(post.Body)
+	switch {
+	case strings.TrimSpace(body) == "":
+		http.Error(w, "Invalid message", http.StatusBadRequest)
+		return
+	case len(body) > h.opts.MaxMessageSize:
+		http.Error(w, fmt.Sprintf("body is over %d bytes", h.opts.MaxMessageSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	env := newEnvelope(protocol.EventChat, room, body)
+	env.Sender = key.name
+	env.Bot = true
+	h.message <- &Message{room: room, env: &env}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Hub) handleRoomStats(w http.ResponseWriter, r *http.Request, room *Room, key *apiKey) {
+	room.mu.RLock()
+	stats := RoomInfo{ID: room.id, Name: room.name, HasPass: room.password != "", UserCount: len(room.clients)}
+	room.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// setOwner makes client the room's owner. Keys minted by a previous owner
+// stop working.
+func (r *Room) setOwner(client *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ownerID = client.publicID
+	clear(r.apiKeys)
+}
+
+// mintOwnerCode gives the room a new owner code, replacing any earlier one,
+// and returns it. The code outlives the owner's connection and, with
+// -persist, a restart.
+func (r *Room) mintOwnerCode() string {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	code := hex.EncodeToString(raw)
+	r.mu.Lock()
+	r.ownerCode = sha256.Sum256([]byte(code))
+	r.mu.Unlock()
+	return code
+}
+
+// claimsOwnership reports whether secret lets a member joining as name take
+// the room over: the room's owner code, or the password of a configured
+// owner by that name, which a guest cannot be.
+func (r *Room) claimsOwnership(name, secret string, guest bool) bool {
+	r.mu.RLock()
+	code := r.ownerCode
+	r.mu.RUnlock()
+	if code != ([sha256.Size]byte{}) && sha256.Sum256([]byte(secret)) == code {
+		return true
+	}
+	return !guest && r.configuredOwner(name, secret)
+}
+
+// handleAPIKeyFrame serves the owner's create_api_key, list_api_keys and
+// revoke_api_key frames. Replies go to the owner alone; a new key's secret
+// is sent once, as the body of its api_key event.
+func (h *Hub) handleAPIKeyFrame(client *Client, frame protocol.Inbound) {
+	room := client.room
+	env := newEnvelope(protocol.EventAPIKey, room, "")
+	room.mu.Lock()
+	switch {
+	case room.ownerID == "" || room.ownerID != client.publicID:
+		env = newEnvelope(protocol.EventSystem, room, "Only the room owner can manage API keys.")
+	case frame.Type == protocol.TypeCreateAPIKey:
+		// Keys post under their name, so it has to be one a member
+		// could go by.
+		if problem := h.opts.usernameProblem(frame.Name); problem != "" {
+			env = newEnvelope(protocol.EventSystem, room, problem)
+			break
+		}
+		key, secret, problem := room.createAPIKey(frame.Name, frame.Scopes)
+		if problem != "" {
+			env = newEnvelope(protocol.EventSystem, room, problem)
+			break
+		}
+		env.Body = secret
+		env.APIKeys = []protocol.APIKeyInfo{key.info()}
+	case frame.Type == protocol.TypeListAPIKeys:
+		env.APIKeys = make([]protocol.APIKeyInfo, 0, len(room.apiKeys))
+		for _, key := range room.apiKeys {
+			env.APIKeys = append(env.APIKeys, key.info())
+		}
+		slices.SortFunc(env.APIKeys, func(a, b protocol.APIKeyInfo) int { return strings.Compare(a.Name, b.Name) })
+	case frame.Type == protocol.TypeRevokeAPIKey:
+		env = newEnvelope(protocol.EventSystem, room, "No API key named "+frame.Name+".")
+		for hash, key := range room.apiKeys {
+			if key.name == frame.Name {
+				delete(room.apiKeys, hash)
+				env.Body = "API key " + frame.Name + " revoked."
+				log.Printf("room=%q api-key=%q revoked", room.name, key.name)
+			}
+		}
+	}
+	room.mu.Unlock()
+	h.sendTo(client, env.Encode())
+}
+
+// createAPIKey validates and stores a new key. The caller must hold r.mu.
+func (r *Room) createAPIKey(name string, scopes []string) (*apiKey, string, string) {
+	if name == "" || len(name) > maxAPIKeyName {
+		return nil, "", "API key names must be 1 to 32 characters."
+	}
+	if len(r.apiKeys) >= maxAPIKeysPerRoom {
+		return nil, "", "This room already has the maximum number of API keys."
+	}
+	for _, key := range r.apiKeys {
+		if key.name == name {
+			return nil, "", "An API key named " + name + " already exists."
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, "", "An API key needs at least one scope."
+	}
+	for _, scope := range scopes {
+		if !knownScope(scope) {
+			return nil, "", "Unknown scope " + scope + "."
+		}
+	}
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", "Failed to generate API key."
+	}
+	secret := hex.EncodeToString(raw)
+	key := &apiKey{name: name, scopes: slices.Compact(slices.Sorted(slices.Values(scopes))), created: time.Now().UTC()}
+	r.apiKeys[sha256.Sum256([]byte(secret))] = key
+	log.Printf("room=%q api-key=%q created scopes=%v", r.name, name, key.scopes)
+	return key, secret, ""
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"chat/protocol"
+)
+
+// mintKey has owner mint a key named name with scopes and returns its secret.
+func mintKey(t *testing.T, owner *testConn, name string, scopes ...string) string {
+	t.Helper()
+	owner.sendFrame(protocol.Inbound{Type: protocol.TypeCreateAPIKey, Name: name, Scopes: scopes})
+	return owner.next(protocol.EventAPIKey).Body
+}
+
+// postMessage posts body as a message to room with the key secret and
+// returns the status.
+func (s *testServer) postMessage(t *testing.T, room, secret, body string) int {
+	t.Helper()
+	data, _ := json.Marshal(map[string]string{"body": body})
+	req, _ := http.NewRequest("POST", s.srv.URL+"/rooms/"+room+"/messages", strings.NewReader(string(data)))
+	req.Header.Set("Authorization", "Bearer "+secret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRoomPostIsSanitized(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner, _ := s.join(t, "action=create&room=ops&username=owner")
+	secret := mintKey(t, owner, "deploys", "post_message")
+
+	if status := s.postMessage(t, "ops", secret, "built\nand\tshipped\x07"); status != http.StatusAccepted {
+		t.Fatalf("status %d, want 202", status)
+	}
+	if got := owner.next(protocol.EventChat); got.Body != "built and shipped" || got.Sender != "deploys" || !got.Bot || got.SenderID != "" {
+		t.Fatalf("chat = %+v", got)
+	}
+	if status := s.postMessage(t, "ops", secret, "\n\t"); status != http.StatusBadRequest {
+		t.Fatalf("blank post: status %d, want 400", status)
+	}
+}
+
+func TestRoomPostSizeLimit(t *testing.T) {
+	s := newTestServer(t, func(o *Options) { o.MaxMessageSize = 128 })
+	owner, _ := s.join(t, "action=create&room=ops&username=owner")
+	secret := mintKey(t, owner, "deploys", "post_message")
+
+	if status := s.postMessage(t, "ops", secret, strings.Repeat("a", 128)); status != http.StatusAccepted {
+		t.Fatalf("post at the limit: status %d, want 202", status)
+	}
+	if status := s.postMessage(t, "ops", secret, strings.Repeat("a", 129)); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("post over the limit: status %d, want 413", status)
+	}
+}
+
+func TestAPIKeyNamesFollowUsernameRules(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner, _ := s.join(t, "action=create&room=ops&username=owner")
+	for _, name := range []string{"", "system", "Guest42", "two words", strings.Repeat("x", 33)} {
+		owner.sendFrame(protocol.Inbound{Type: protocol.TypeCreateAPIKey, Name: name, Scopes: []string{"post_message"}})
+		for {
+			got, err := owner.read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Type == protocol.EventAPIKey {
+				t.Errorf("created a key named %q", name)
+			}
+			if got.Type == protocol.EventAPIKey || got.Type == protocol.EventSystem {
+				break
+			}
+		}
+	}
+	mintKey(t, owner, "deploy-bot", "post_message")
+}
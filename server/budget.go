@@ -0,0 +1,98 @@
+package server
+
+import "sync"
+
+// Room classes. Provisioned rooms are provisioned unless -rooms-config says
+// admin; every other room is public.
+const (
+	classPublic      = "public"
+	classProvisioned = "provisioned"
+	classAdmin       = "admin"
+)
+
+// connectionBudget enforces -max-connections while keeping each class's
+// reserve free of public traffic. A connection draws on its class's reserve
+// first and on the shared pool after that.
+type connectionBudget struct {
+	mu       sync.Mutex
+	max      int
+	reserved map[string]int
+	classes  map[string]*classUsage
+	shared   int
+}
+
+type classUsage struct {
+	Reserved    int    `json:"reserved"`
+	FromReserve int    `json:"fromReserve"`
+	FromShared  int    `json:"fromShared"`
+	Rejected    uint64 `json:"rejected"`
+}
+
+func newConnectionBudget(o *Options) *connectionBudget {
+	return &connectionBudget{
+		max: o.MaxConnections,
+		reserved: map[string]int{
+			classProvisioned: o.ReservedProvisioned,
+			classAdmin:       o.ReservedAdmin,
+		},
+		classes: map[string]*classUsage{
+			classPublic:      {},
+			classProvisioned: {},
+			classAdmin:       {},
+		},
+	}
+}
+
+// take debits one connection for class, returning the func that gives it
+// back, or false if both the class reserve and the shared pool are spent.
+func (b *connectionBudget) take(class string) (release func(), ok bool) {
+	if b.max <= 0 {
+		return func() {}, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	usage := b.classes[class]
+	if usage.FromReserve < b.reserved[class] {
+		usage.FromReserve++
+		return b.releaser(func() { usage.FromReserve-- }), true
+	}
+	if b.shared < b.max-b.reserved[classProvisioned]-b.reserved[classAdmin] {
+		b.shared++
+		usage.FromShared++
+		return b.releaser(func() { b.shared--; usage.FromShared-- }), true
+	}
+	usage.Rejected++
+	return nil, false
+}
+
+func (b *connectionBudget) releaser(undo func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			undo()
+			b.mu.Unlock()
+		})
+	}
+}
+
+func (b *connectionBudget) stats() map[string]classUsage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := make(map[string]classUsage, len(b.classes))
+	for class, usage := range b.classes {
+		snapshot := *usage
+		snapshot.Reserved = b.reserved[class]
+		stats[class] = snapshot
+	}
+	return stats
+}
+
+func (r *Room) roomClass() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.class == "" {
+		return classPublic
+	}
+	return r.class
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProvisionedReserveOutlastsPublicRooms(t *testing.T) {
+	s := newTestServer(t, func(o *Options) {
+		o.MaxConnections, o.ReservedProvisioned = 3, 1
+	})
+	configs, err := parseRoomsConfig([]byte(`[{"name": "support"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.provisionRooms(configs, false); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, _ := s.join(t, "room=lobby&username=alice")
+	s.join(t, "room=lobby&username=bob")
+	if status := s.dialStatus(t, "room=lobby&username=carol"); status != http.StatusServiceUnavailable {
+		t.Fatalf("third public join: status %d, want 503", status)
+	}
+	s.join(t, "room=support&username=dana")
+	if status := s.dialStatus(t, "room=support&username=erin"); status != http.StatusServiceUnavailable {
+		t.Fatalf("provisioned join past the reserve and a full pool: status %d, want 503", status)
+	}
+
+	alice.conn.Close()
+	waitFor(t, "alice's slot to be returned", func() bool { return s.memberCount("lobby") == 1 })
+	s.join(t, "room=lobby&username=carol")
+	if got := s.budget.stats()[classPublic]; got.FromShared != 2 || got.Rejected != 1 {
+		t.Fatalf("public usage = %+v, want 2 from the shared pool and 1 rejected", got)
+	}
+}
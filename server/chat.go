@@ -0,0 +1,841 @@
+// Package server is the temp-chat server: rooms, the /ws protocol and the HTTP
+// endpoints around them. The command in the module root wires it to flags.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"log"
+	mathrand "math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chat/internal/id"
+	"chat/protocol"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Client is a connection's membership in one room. A connection in several
+// rooms has a Client for each, sharing its session.
+type Client struct {
+	*session
+	publicID  string
+	username  atomic.Pointer[string]
+	room      *Room
+	reminders reminderList
+	// replay is set when the client joined with ?since=, asking for the
+	// chat frames numbered after since; windowed clients take them in
+	// history events instead. since changes only under the room's lock.
+	replay   bool
+	windowed bool
+	since    uint64
+	// limiter holds the connection to the room's limits, and sent counts
+	// the chat and direct messages sent to it; both belong to the
+	// connection's read loop.
+	limiter *inboundLimiter
+	sent    uint64
+	// ownerCode is the code minted when this membership made the client
+	// owner, sent once in its hello.
+	ownerCode string
+}
+
+// nick is the member's name in its room. It changes, through setNick, only
+// under the room's lock, but may be read without it.
+func (c *Client) nick() string {
+	if name := c.username.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+func (c *Client) setNick(name string) {
+	c.username.Store(&name)
+}
+
+type Room struct {
+	id          id.ID
+	name        string
+	password    string
+	private     bool
+	provisioned bool
+	// class picks the connection reserve the room draws on; "" is public.
+	class string
+	// capacity caps the room's members; 0 means unlimited.
+	capacity int
+	// requireUsername turns away joins that leave the server to pick a guest
+	// name.
+	requireUsername bool
+	// topic describes the room in the lobby; the owner sets it.
+	topic string
+	// owners maps the names of a provisioned room's configured owners to
+	// their password hashes; see roomConfig.Owners.
+	owners map[string]string
+	// lastActivity is the UnixNano time of the last join or broadcast; see
+	// -room-idle-ttl.
+	lastActivity atomic.Int64
+	clients      map[*websocket.Conn]*Client
+	names        map[string]*Client
+	publicIDs    map[string]*Client
+	ownerID      string
+	// ownerCode is the sha256 of the code handed to whoever created or
+	// reserved the room, zero if there is none; see claimsOwnership.
+	ownerCode   [sha256.Size]byte
+	operators   map[string]bool
+	bannedNames map[string]bool
+	bannedIPs   map[string]bool
+	apiKeys     map[[sha256.Size]byte]*apiKey
+	// rejoinCodes holds the codes /private handed out.
+	rejoinCodes map[[sha256.Size]byte]*rejoinCode
+	invites     map[[sha256.Size]byte]*invite
+	// reminders are those restored with -persist whose member has not yet
+	// rejoined.
+	reminders []*heldReminder
+	// seq numbers the room's chat events; replay keeps the latest of them.
+	seq    uint64
+	replay replayBuffer
+	// senders rate-limits /rooms/send by IP.
+	senders map[string]*tokenBucket
+	storm   presenceStorm
+	// pendingPresence holds join and leave events until the next flush.
+	pendingPresence []protocol.Envelope
+	limiter         roomBucket
+	rateProfile     rateProfile
+	mu              sync.RWMutex
+}
+
+// Hub is a chat server: its rooms, their members and everything that expires.
+// Create one with NewHub, serve its routes with Register and drive it with
+// Run.
+type Hub struct {
+	opts         Options
+	upgrader     websocket.Upgrader
+	rooms        *roomMap
+	register     chan *Client
+	unregister   chan *Client
+	message      chan *Message
+	janitor      *janitor
+	attempts     *attemptLimiter
+	reservations *reservationStore
+	connections  *connectionRegistry
+	clientErrors *clientErrorCounter
+	admission    *admissionController
+	budget       *connectionBudget
+	lifecycle    *lifecycleRegistry
+	// store is nil unless Options.Persist is set, usage unless
+	// Options.DailyReport is.
+	store    *roomStore
+	usage    *usageCounters
+	draining atomic.Bool
+	// nextClientID numbers connections for internal use only; it must
+	// never reach the wire, where publicID identifies the client instead.
+	nextClientID    atomic.Uint64
+	remindersMissed atomic.Uint64
+}
+
+func foldName(name string) string {
+	return strings.ToLower(name)
+}
+
+var publicIDEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newPublicID returns 8 random base32 characters. Unlike Client.id it says
+// nothing about how many clients came before.
+func newPublicID() string {
+	raw := make([]byte, 5)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	return strings.ToLower(publicIDEncoding.EncodeToString(raw))
+}
+
+// reserve assigns the client a unique public id and the first free variant
+// of name (name, name1, name2, ...) under case-folding, recording both in the
+// room's indexes in one critical section so concurrent joins cannot collide.
+// It reports false, reserving nothing, if the room is at capacity; reserved
+// clients count toward it before they register.
+func (r *Room) reserve(client *Client, name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.capacity > 0 && len(r.publicIDs) >= r.capacity {
+		return false
+	}
+
+	publicID := newPublicID()
+	for r.publicIDs[publicID] != nil {
+		publicID = newPublicID()
+	}
+	r.publicIDs[publicID] = client
+	client.publicID = publicID
+
+	unique := r.uniqueName(name)
+	r.names[foldName(unique)] = client
+	client.setNick(unique)
+	return true
+}
+
+// uniqueName returns name, numbered if a member already has it. The caller
+// must hold r.mu.
+func (r *Room) uniqueName(name string) string {
+	if _, taken := r.names[foldName(name)]; !taken {
+		return name
+	}
+	for i := 1; i <= 100; i++ {
+		candidate := fmt.Sprintf("%s%d", name, i)
+		if _, taken := r.names[foldName(candidate)]; !taken {
+			return candidate
+		}
+	}
+	return fmt.Sprintf("%s%x", name, time.Now().UnixNano())
+}
+
+// release drops the client's index entries. The caller must hold r.mu.
+func (r *Room) release(client *Client) {
+	key := foldName(client.nick())
+	if r.names[key] == client {
+		delete(r.names, key)
+	}
+	if r.publicIDs[client.publicID] == client {
+		delete(r.publicIDs, client.publicID)
+	}
+}
+
+// full reports whether the room is at capacity, for the pre-upgrade check;
+// reserve makes the binding decision.
+func (r *Room) full() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.capacity > 0 && len(r.publicIDs) >= r.capacity
+}
+
+func (r *Room) lookupName(name string) *Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.names[foldName(name)]
+}
+
+// Message is a frame queued for delivery by the hub. senderMsg holds an
+// encoded protocol.Envelope; when recipient is set only that client receives
+// it.
+type Message struct {
+	room      *Room
+	senderID  uint64
+	recipient *Client
+	// env is a chat event the hub numbers before broadcasting it;
+	// senderMsg is used as is.
+	env       *protocol.Envelope
+	senderMsg []byte
+	sysMsg    []byte
+}
+
+// NewHub checks opts and builds a hub from them, creating the rooms from
+// Options.RoomsConfig and Options.Persist when set. Nothing runs until Run.
+func NewHub(opts Options) (*Hub, error) {
+	return newHub(opts, realClock{})
+}
+
+// newHub is NewHub with the clock the janitor runs on, which tests replace.
+func newHub(opts Options, c clock) (*Hub, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	j := newJanitor(c)
+	h := &Hub{
+		opts:         opts,
+		rooms:        newRoomMap(),
+		register:     make(chan *Client),
+		unregister:   make(chan *Client),
+		message:      make(chan *Message),
+		janitor:      j,
+		attempts:     newAttemptLimiter(j, opts.JoinAttempts),
+		reservations: newReservationStore(j, opts.ReservationsPerIP),
+		connections:  newConnectionRegistry(j),
+		clientErrors: newClientErrorCounter(j),
+		admission:    newAdmissionController(&opts, j.clock),
+		budget:       newConnectionBudget(&opts),
+		lifecycle:    newLifecycleRegistry(),
+	}
+	h.upgrader.CheckOrigin = h.checkOrigin
+	if opts.RoomsConfig != "" {
+		configs, err := loadRoomsConfig(opts.RoomsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("load rooms config: %v", err)
+		}
+		if err := h.provisionRooms(configs, false); err != nil {
+			return nil, fmt.Errorf("provision rooms: %v", err)
+		}
+	}
+	if opts.Persist != "" {
+		if err := h.restoreRooms(opts.Persist); err != nil {
+			return nil, fmt.Errorf("restore rooms: %v", err)
+		}
+	}
+	if opts.RoomIdleTTL > 0 {
+		h.scheduleIdleSweep()
+	}
+	if opts.DailyReport != "" {
+		loc, err := opts.reportLocation()
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(opts.DailyReport); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("-daily-report %s is not a directory", opts.DailyReport)
+		}
+		h.usage = newUsageCounters(loc)
+		h.scheduleDailyReport()
+	}
+	return h, nil
+}
+
+func (h *Hub) newRoom(name, passwordHash string, isPrivate bool) *Room {
+	room := &Room{
+		id:          id.New(),
+		name:        name,
+		password:    passwordHash,
+		private:     isPrivate,
+		clients:     make(map[*websocket.Conn]*Client),
+		names:       make(map[string]*Client),
+		publicIDs:   make(map[string]*Client),
+		operators:   make(map[string]bool),
+		bannedNames: make(map[string]bool),
+		bannedIPs:   make(map[string]bool),
+		apiKeys:     make(map[[sha256.Size]byte]*apiKey),
+		limiter:     roomBucket{tokenBucket: newTokenBucket(h.opts.RoomMsgRate, h.opts.RoomMsgBurst)},
+		rateProfile: h.opts.startingProfile(),
+	}
+	room.touch(h.janitor.clock.Now())
+	return room
+}
+
+func (h *Hub) createRoom(name, password string, isPrivate bool, capacity int, requireUsername bool, topic string) (*Room, bool) {
+	if h.rooms.get(name) != nil {
+		return nil, false
+	}
+
+	var hashedPassword string
+	if password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			log.Printf("Failed to hash password: %v", err)
+			return nil, false
+		}
+		hashedPassword = hash
+	}
+
+	room := h.newRoom(name, hashedPassword, isPrivate)
+	room.capacity = capacity
+	room.requireUsername = requireUsername
+	room.topic = topic
+	if !h.rooms.insert(room) {
+		return nil, false
+	}
+	h.roomsChanged()
+	h.usage.roomCreated()
+	return room, true
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *Hub) getRoom(name string) *Room {
+	return h.rooms.get(name)
+}
+
+func (h *Hub) checkRoomPassword(name, username, password string) bool {
+	room := h.rooms.get(name)
+	if room == nil {
+		return false
+	}
+	room.mu.RLock()
+	hash := room.password
+	rejoin := room.hasRejoinCode(password, username)
+	room.mu.RUnlock()
+	if hash == "" || rejoin {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// checkPassword reports whether password is the room's own, ignoring rejoin
+// codes, for callers that could not spend one.
+func (r *Room) checkPassword(password string) bool {
+	r.mu.RLock()
+	hash := r.password
+	r.mu.RUnlock()
+	return hash == "" || bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// removeRoom removes the room if it is empty and not provisioned. Rooms
+// stay while draining; see Drain.
+func (h *Hub) removeRoom(name string) {
+	if h.draining.Load() {
+		return
+	}
+	removed := h.rooms.removeIf(name, func(room *Room) bool {
+		return len(room.clients) == 0 && !room.provisioned
+	})
+	if removed {
+		h.roomsChanged()
+		h.usage.roomRemoved()
+	}
+}
+
+// broadcastToRoom sends data to every member except the sender, unless the
+// sender asked for echo. senderID 0 marks a system message for everyone.
+func (h *Hub) broadcastToRoom(room *Room, senderID uint64, data []byte) {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	for _, client := range room.clients {
+		if senderID != 0 && client.id == senderID && !client.echo {
+			continue
+		}
+		client.enqueue(data)
+	}
+}
+
+// sendTo delivers data to a single member if it is still in its room, and
+// reports whether it was queued.
+func (h *Hub) sendTo(client *Client, data []byte) bool {
+	room := client.room
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	if room.clients[client.conn] != client {
+		return false
+	}
+	return client.enqueue(data)
+}
+
+// deliver queues msg for its recipient, or numbers it and fans it out to its
+// room, on Run.
+func (h *Hub) deliver(msg *Message) {
+	if msg.recipient != nil {
+		h.sendTo(msg.recipient, msg.senderMsg)
+		return
+	}
+	msg.room.touch(h.janitor.clock.Now())
+	h.usage.message(msg.room)
+	h.flushPresence(msg.room)
+	data := msg.senderMsg
+	if msg.env != nil {
+		data = h.sequence(msg.room, msg.env)
+	}
+	h.broadcastToRoom(msg.room, msg.senderID, data)
+}
+
+// Run drives the hub until ctx is done: it registers and unregisters
+// members, fans out messages and fires everything scheduled to expire. Call
+// Drain before cancelling ctx to disconnect clients cleanly.
+func (h *Hub) Run(ctx context.Context) {
+	h.lifecycle.add("hub.run")
+	defer h.lifecycle.done("hub.run")
+	h.spawn("hub.janitor", func() { h.janitor.run(ctx) })
+	if h.store != nil {
+		h.spawn("hub.persist", func() { h.persistRooms(ctx) })
+	}
+	for {
+		select {
+		case client := <-h.register:
+			room := client.room
+			room.mu.Lock()
+			if !client.attached(client) {
+				room.release(client)
+				room.mu.Unlock()
+				continue
+			}
+			room.touch(h.janitor.clock.Now())
+			room.clients[client.conn] = client
+			client.registered++
+			roomCount := len(room.clients)
+			client.enqueue(helloEnvelope(client).Encode())
+			if room.topic != "" {
+				client.enqueue(newEnvelope(protocol.EventSystem, room, "Topic: "+room.topic).Encode())
+			}
+			h.replayTo(client, room)
+			h.adoptReminders(client)
+			quiet := room.storm.noteJoin(client.nick())
+			room.mu.Unlock()
+			event := "joined"
+			if !client.opened {
+				client.opened, event = true, "connected"
+				h.connections.opened(client.connID)
+				h.usage.connected(client.ip, client.nick())
+			}
+			log.Printf("conn=%s room=%q user=%q %s", client.connID, room.name, client.nick(), event)
+			env := presenceEnvelope(protocol.EventJoin, client, client.nick()+" joined", roomCount)
+			env.Quiet = quiet
+			h.queuePresence(room, env)
+
+		case client := <-h.unregister:
+			room := client.room
+			room.mu.Lock()
+			if room.clients[client.conn] == client {
+				delete(room.clients, client.conn)
+				room.release(client)
+				// The connection ends with its last room, and the read
+				// loop has given up its rooms only once it is closed.
+				client.registered--
+				last := client.registered == 0 && client.isClosed()
+				if last {
+					close(client.send)
+					client.release()
+				}
+				roomCount := len(room.clients)
+				quiet, started := room.storm.noteLeave(h.janitor.clock.Now(), client.nick(), h.opts.StormLeaves, h.opts.StormWindow)
+				room.mu.Unlock()
+				h.cancelReminders(client)
+				event := "left"
+				if last {
+					event = "disconnected"
+					h.connections.closed(client.connID)
+					h.usage.disconnected()
+				}
+				log.Printf("conn=%s room=%q user=%q %s", client.connID, room.name, client.nick(), event)
+				if started {
+					log.Printf("room=%q mass disconnect, summarizing presence for %s", room.name, h.opts.StormCooldown)
+					h.scheduleStormEnd(room)
+				}
+				notice := client.nick() + " left"
+				if client.slow.Load() {
+					notice = client.nick() + " disconnected (slow consumer)"
+					h.usage.countError("slow_consumer")
+				}
+				env := presenceEnvelope(protocol.EventLeave, client, notice, roomCount)
+				env.Quiet = quiet
+				h.queuePresence(room, env)
+				if roomCount == 0 {
+					h.removeRoom(room.name)
+					if h.opts.LeakCheck {
+						h.scheduleLeakCheck()
+					}
+				}
+			} else {
+				room.mu.Unlock()
+			}
+
+		case msg := <-h.message:
+			h.deliver(msg)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// HandleWebSocket upgrades a join request on /ws and serves the connection
+// until it closes.
+func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() || !h.admission.admit(r) {
+		h.usage.countError("join_shed")
+		shedResponse(w)
+		return
+	}
+	req := parseJoinRequest(r)
+	if jerr := h.checkJoin(req); jerr != nil {
+		h.usage.countError("join_" + jerr.Code)
+		jerr.write(w)
+		return
+	}
+
+	username, _ := h.joinUsername(req.username)
+	guest := username == ""
+	if guest {
+		username = fmt.Sprintf("Guest%04d", mathrand.IntN(10000))
+	}
+
+	var room *Room
+	// The creator owns the room, and so does whoever redeems its reservation
+	// by joining it into being or joins as one of its configured owners.
+	owner := req.action == "create"
+	if owner {
+		createdRoom, ok := h.createRoom(req.room, req.password, req.private, req.capacity, req.requireUsername, req.topic)
+		if !ok {
+			http.Error(w, "Room already exists", http.StatusConflict)
+			return
+		}
+		room = createdRoom
+		h.reservations.redeem(req.room)
+	} else {
+		room = h.getRoom(req.room)
+		switch {
+		case req.invite != "":
+			if room == nil || !room.useInvite(req.invite) {
+				invalidInvite.write(w)
+				return
+			}
+		case room == nil:
+			if created, ok := h.createRoom(req.room, "", false, 0, false, ""); ok {
+				room = created
+				owner = h.reservations.redeem(req.room)
+				break
+			}
+			// Another join created the room first: join it as it is now,
+			// with the checks it was spared for not existing.
+			room = h.getRoom(req.room)
+			if room == nil {
+				http.Error(w, "Could not create room", http.StatusServiceUnavailable)
+				return
+			}
+			if jerr := h.checkJoin(req); jerr != nil {
+				h.usage.countError("join_" + jerr.Code)
+				jerr.write(w)
+				return
+			}
+			if !room.spendRejoinCode(req.password, username) {
+				http.Error(w, "Invalid password", http.StatusUnauthorized)
+				return
+			}
+		case !room.spendRejoinCode(req.password, username):
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+			return
+		}
+	}
+	release, ok := h.budget.take(room.roomClass())
+	if !ok {
+		h.removeRoom(room.name)
+		shedResponse(w)
+		return
+	}
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("upgrade error:", err)
+		release()
+		// Do not leave behind a room this request created.
+		h.removeRoom(room.name)
+		return
+	}
+
+	client := &Client{
+		session: &session{
+			id:      h.nextClientID.Add(1),
+			connID:  newPublicID(),
+			ip:      req.ip,
+			conn:    conn,
+			send:    make(chan []byte, h.opts.SendBuffer),
+			quit:    make(chan struct{}),
+			release: release,
+			echo:    req.echo,
+			name:    username,
+			guest:   guest,
+
+			connectedAt: time.Now(),
+		},
+		room:     room,
+		replay:   req.replay,
+		windowed: req.windowed,
+		since:    req.since,
+	}
+	client.attach(client)
+	if !room.reserve(client, username) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeRoomFull, "room full"), time.Now().Add(h.opts.WriteWait))
+		conn.Close()
+		release()
+		return
+	}
+	if owner {
+		client.ownerCode = room.mintOwnerCode()
+		h.roomsChanged()
+	}
+	if owner || req.owner != "" && room.claimsOwnership(username, req.owner, guest) {
+		room.setOwner(client)
+	}
+	h.spawn("conn.write", func() { client.writePump(h.opts.PingInterval, h.opts.WriteWait) })
+
+	h.register <- client
+
+	h.spawn("conn.read", func() {
+		defer func() {
+			for _, member := range client.leaveAll() {
+				h.unregister <- member
+			}
+		}()
+		client.keepAlive(h.opts.PongWait)
+		conn.SetReadLimit(int64(h.opts.MaxMessageSize) * readLimitFactor)
+		client.limiter = newInboundLimiter(room, room.currentRateProfile(), h.opts.MsgStrikes)
+		oversized := 0
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				break
+			}
+			// Notices about the connection go to its first room, which
+			// frames naming no room go to as well. A frame counts against
+			// the limits of the room it is for; one that is not for a
+			// room the connection is in, such as a join, counts against
+			// the first room's.
+			first := client.member("")
+			target := first
+			var frame protocol.Inbound
+			parsed := false
+			if messageType == websocket.TextMessage && len(message) <= h.opts.MaxMessageSize {
+				frame, parsed = protocol.ParseInbound(message)
+				if m := client.member(frame.Room); parsed && m != nil && frame.Type != protocol.TypeJoin && frame.Type != protocol.TypeLeave {
+					target = m
+				}
+			}
+			switch target.limiter.check(time.Now(), target.room.currentRateProfile()) {
+			case limitDrop:
+				continue
+			case limitWarnClient:
+				notice := newEnvelope(protocol.EventSystem, target.room, "You are sending messages too fast; some were not delivered.")
+				h.message <- &Message{room: target.room, recipient: target, senderMsg: notice.Encode()}
+				continue
+			case limitWarnRoom:
+				notice := newEnvelope(protocol.EventSystem, target.room, "This room is busy; some of your messages were not delivered.")
+				h.message <- &Message{room: target.room, recipient: target, senderMsg: notice.Encode()}
+				continue
+			case limitDisconnect:
+				log.Printf("conn=%s room=%q user=%q rate limited", client.connID, target.room.name, target.nick())
+				h.usage.countError("rate_limited")
+				client.kick(websocket.ClosePolicyViolation, "rate limit exceeded")
+				continue
+			}
+			if messageType != websocket.TextMessage {
+				notice := newEnvelope(protocol.EventSystem, first.room, "Only text frames are supported.")
+				h.message <- &Message{room: first.room, recipient: first, senderMsg: notice.Encode()}
+				continue
+			}
+			if len(message) > h.opts.MaxMessageSize {
+				if oversized++; oversized > oversizeStrikes {
+					log.Printf("conn=%s room=%q user=%q sent too many oversized frames", client.connID, room.name, client.nick())
+					h.usage.countError("message_too_big")
+					client.kick(websocket.CloseMessageTooBig, "message too big")
+					continue
+				}
+				notice := newEnvelope(protocol.EventSystem, first.room, fmt.Sprintf("Message not sent: it is over %d bytes.", h.opts.MaxMessageSize))
+				h.message <- &Message{room: first.room, recipient: first, senderMsg: notice.Encode()}
+				continue
+			}
+			if !parsed {
+				notice := newEnvelope(protocol.EventSystem, first.room, "Unsupported message type: "+sanitizeText(frame.Type))
+				h.message <- &Message{room: first.room, recipient: first, senderMsg: notice.Encode()}
+				continue
+			}
+			frame.Body = sanitizeText(frame.Body)
+			switch frame.Type {
+			case protocol.TypeJoin:
+				h.joinRoom(client, frame.Room, frame.Password)
+				continue
+			case protocol.TypeLeave:
+				h.leaveRoom(client, frame.Room)
+				continue
+			}
+			member := client.member(frame.Room)
+			if member == nil {
+				notice := newEnvelope(protocol.EventSystem, first.room, "You are not in "+sanitizeText(frame.Room)+".")
+				h.message <- &Message{room: first.room, recipient: first, senderMsg: notice.Encode()}
+				continue
+			}
+			switch frame.Type {
+			case protocol.EventDM:
+				member.sent++
+				h.sendDirect(member, frame.To, frame.Body)
+				continue
+			case protocol.TypeWhoami:
+				h.sendWhoami(member)
+				continue
+			case protocol.TypeHistoryMore:
+				h.sendHistoryMore(member, frame.Before)
+				continue
+			case protocol.TypeCreateAPIKey, protocol.TypeListAPIKeys, protocol.TypeRevokeAPIKey:
+				h.handleAPIKeyFrame(member, frame)
+				continue
+			}
+			if h.runCommand(member, frame.Body) {
+				continue
+			}
+			member.sent++
+			env := chatEnvelope(member, frame.Body)
+			h.message <- &Message{room: member.room, senderID: member.id, env: &env}
+		}
+	})
+}
+
+type RoomInfo struct {
+	ID        id.ID  `json:"id"`
+	Name      string `json:"name"`
+	HasPass   bool   `json:"hasPass"`
+	UserCount int    `json:"userCount"`
+	Capacity  int    `json:"capacity,omitempty"`
+	// RequireUsername rooms refuse guests without a chosen name.
+	RequireUsername bool   `json:"requireUsername,omitempty"`
+	Topic           string `json:"topic,omitempty"`
+}
+
+// HandleRooms lists the public rooms on /rooms.
+func (h *Hub) HandleRooms(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if !h.checkRoomsToken(w, r) {
+		return
+	}
+
+	rooms := make([]RoomInfo, 0)
+	h.rooms.each(func(room *Room) {
+		room.mu.RLock()
+		defer room.mu.RUnlock()
+		if room.private {
+			return
+		}
+		rooms = append(rooms, RoomInfo{
+			ID:              room.id,
+			Name:            room.name,
+			HasPass:         room.password != "",
+			UserCount:       len(room.clients),
+			Capacity:        room.capacity,
+			RequireUsername: room.requireUsername,
+			Topic:           room.topic,
+		})
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]RoomInfo{"rooms": rooms})
+}
+
+// Register adds every route the server answers to mux: the frontend unless
+// Options.NoStatic, the join and room endpoints, and the /debug/ endpoints
+// with Options.Debug.
+func (h *Hub) Register(mux *http.ServeMux) {
+	if !h.opts.NoStatic {
+		frontend := h.frontendFS()
+		mux.Handle("/", newFrontendHandler(frontend))
+		mux.Handle("GET /room/{name}", newRoomPreviewHandler(h, frontend))
+	}
+	mux.HandleFunc("/config.json", h.handleClientConfig)
+	mux.HandleFunc("/ws", h.HandleWebSocket)
+	mux.HandleFunc("/ws/preflight", h.HandlePreflight)
+	mux.HandleFunc("/rooms", h.HandleRooms)
+	mux.HandleFunc("/rooms/reserve", h.handleReserve)
+	mux.HandleFunc("/rooms/invite", h.handleInvite)
+	mux.HandleFunc("/rooms/send", h.handleSend)
+	mux.HandleFunc("GET /rooms/{name}/users", h.handleRoomUsers)
+	h.registerRoomRoutes(mux)
+	mux.HandleFunc("/client-errors", h.handleClientErrors)
+	if h.opts.Debug {
+		mux.HandleFunc("/debug/lifecycle", h.handleLifecycle)
+		mux.HandleFunc("/debug/janitor", h.handleJanitor)
+		mux.HandleFunc("/debug/client-errors", h.handleClientErrorStats)
+		mux.HandleFunc("/debug/admission", h.handleAdmission)
+		if h.usage != nil {
+			mux.HandleFunc("/debug/report", h.handleReport)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const kickFlushTimeout = time.Second
+
+// session is one websocket connection, in however many rooms.
+type session struct {
+	id       uint64
+	connID   string
+	ip       string
+	conn     *websocket.Conn
+	send     chan []byte
+	quit     chan struct{}
+	quitOnce sync.Once
+	quitMsg  []byte
+	// echo asks for the client's own chat messages to be sent back to it.
+	echo bool
+	// slow is set when the client is dropped for not keeping up.
+	slow atomic.Bool
+	// release returns the client's slot in the connection budget.
+	release func()
+	// name is what the connection is called in the rooms it joins by
+	// frame, numbered there if taken; guest marks a generated name.
+	name  string
+	guest bool
+	// connectedAt is when the join was accepted.
+	connectedAt time.Time
+	// mu guards rooms, the memberships frames go to in the order they
+	// were joined, and closed, set once the read loop has given them up.
+	// registered counts the memberships Run has registered, and opened
+	// records that Run has counted the connection; only Run touches them.
+	mu         sync.Mutex
+	rooms      []*Client
+	closed     bool
+	registered int
+	opened     bool
+}
+
+// keepAlive arms the read deadline and extends it whenever a pong arrives,
+// so a peer that stops answering pings within pongWait fails its next read.
+func (s *session) keepAlive(pongWait time.Duration) {
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+}
+
+// enqueue queues data for the client's write pump without blocking. A client
+// whose buffer is full is disconnected rather than stalling the room. The
+// caller must hold the room lock (read or write) and have checked that the
+// client is still a member, since unregister closes send under the lock of
+// the last room the connection leaves.
+func (s *session) enqueue(data []byte) bool {
+	select {
+	case s.send <- data:
+		return true
+	default:
+		s.slow.Store(true)
+		s.kick(websocket.CloseTryAgainLater, "slow consumer")
+		return false
+	}
+}
+
+// kick asks the write pump to close the connection with the given code. The
+// read loop then fails and unregisters the client through the hub as usual.
+func (s *session) kick(code int, reason string) {
+	s.quitOnce.Do(func() {
+		s.quitMsg = websocket.FormatCloseMessage(code, reason)
+		close(s.quit)
+	})
+}
+
+// writePump is the only goroutine that writes to or closes the connection.
+// Every write must finish within writeWait; a peer too slow for that is
+// dropped as a slow consumer.
+func (s *session) writePump(pingInterval, writeWait time.Duration) {
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		s.conn.Close()
+	}()
+	write := func(messageType int, data []byte) bool {
+		s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		err := s.conn.WriteMessage(messageType, data)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			s.slow.Store(true)
+		}
+		return err == nil
+	}
+	for {
+		select {
+		case <-ticker.C:
+			if !write(websocket.PingMessage, nil) {
+				return
+			}
+		case data, ok := <-s.send:
+			if !ok {
+				write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if !write(websocket.TextMessage, data) {
+				return
+			}
+		case <-s.quit:
+			s.flush()
+			s.conn.SetWriteDeadline(time.Now().Add(kickFlushTimeout))
+			s.conn.WriteMessage(websocket.CloseMessage, s.quitMsg)
+			return
+		}
+	}
+}
+
+// flush writes frames that were queued before a kick, such as the notice
+// explaining it, giving up after kickFlushTimeout.
+func (s *session) flush() {
+	s.conn.SetWriteDeadline(time.Now().Add(kickFlushTimeout))
+	for {
+		select {
+		case data, ok := <-s.send:
+			if !ok {
+				return
+			}
+			if err := s.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
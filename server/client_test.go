@@ -0,0 +1,104 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"chat/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConcurrentFlood(t *testing.T) {
+	s := newTestServer(t, func(o *Options) {
+		o.MsgBurst, o.MaxMsgBurst, o.RoomMsgBurst = 1000, 1000, 1000
+	})
+	const clients, each = 5, 50
+	conns := make([]*testConn, clients)
+	for i := range conns {
+		conns[i], _ = s.join(t, fmt.Sprintf("room=flood&username=user%d", i))
+	}
+	waitFor(t, "everyone to join", func() bool { return s.memberCount("flood") == clients })
+
+	var wg sync.WaitGroup
+	for i, c := range conns {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for n := range each {
+				if err := c.conn.WriteMessage(websocket.TextMessage, fmt.Appendf(nil, "%d-%d", i, n)); err != nil {
+					t.Errorf("user%d send: %v", i, err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for got := 0; got < (clients-1)*each; {
+				env, err := c.read()
+				if err != nil {
+					t.Errorf("user%d got %d chats, want %d: %v", i, got, (clients-1)*each, err)
+					return
+				}
+				if env.Type == protocol.EventChat {
+					got++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestClientKilledMidBroadcast(t *testing.T) {
+	s := newTestServer(t, func(o *Options) {
+		o.MsgBurst, o.MaxMsgBurst, o.RoomMsgBurst = 1000, 1000, 1000
+	})
+	sender, _ := s.join(t, "room=lobby&username=sender")
+	victim, _ := s.join(t, "room=lobby&username=victim")
+	const others, messages = 3, 100
+	conns := make([]*testConn, others)
+	for i := range conns {
+		conns[i], _ = s.join(t, fmt.Sprintf("room=lobby&username=other%d", i))
+	}
+	waitFor(t, "everyone to join", func() bool { return s.memberCount("lobby") == others+2 })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := range messages {
+			if n == messages/2 {
+				victim.conn.UnderlyingConn().Close()
+			}
+			if err := sender.conn.WriteMessage(websocket.TextMessage, fmt.Appendf(nil, "m%d", n)); err != nil {
+				t.Errorf("send: %v", err)
+				return
+			}
+		}
+	}()
+	for i, c := range conns {
+		left := false
+		for got := 0; got < messages || !left; {
+			env, err := c.read()
+			if err != nil {
+				t.Fatalf("other%d after %d chats: %v", i, got, err)
+			}
+			switch env.Type {
+			case protocol.EventLeave:
+				left = left || env.Sender == "victim"
+			case protocol.EventChat:
+				if want := fmt.Sprintf("m%d", got); env.Body != want {
+					t.Fatalf("other%d got %q, want %q", i, env.Body, want)
+				}
+				got++
+			}
+		}
+	}
+	<-done
+	if n := s.memberCount("lobby"); n != others+1 {
+		t.Fatalf("%d members, want %d", n, others+1)
+	}
+	if s.getRoom("lobby").lookupName("victim") != nil {
+		t.Fatal("the killed client's name is still taken")
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	clientErrorBodyLimit   = 4096
+	clientErrorDetailLimit = 1024
+	clientErrorUALimit     = 256
+	clientErrorsPerMinute  = 10
+	clientErrorKindLimit   = 50
+	// connectionGrace is how long after disconnecting a connection id may
+	// still be referenced by an error report.
+	connectionGrace = 10 * time.Minute
+)
+
+var clientErrorKind = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// connectionRegistry remembers live connection ids and recently closed ones.
+type connectionRegistry struct {
+	mu      sync.Mutex
+	janitor *janitor
+	known   map[string]bool
+}
+
+func newConnectionRegistry(j *janitor) *connectionRegistry {
+	return &connectionRegistry{janitor: j, known: make(map[string]bool)}
+}
+
+func (c *connectionRegistry) opened(connID string) {
+	c.mu.Lock()
+	c.known[connID] = true
+	c.mu.Unlock()
+}
+
+func (c *connectionRegistry) closed(connID string) {
+	c.janitor.schedule("connection-grace", connectionGrace, func() {
+		c.mu.Lock()
+		delete(c.known, connID)
+		c.mu.Unlock()
+	})
+}
+
+func (c *connectionRegistry) isKnown(connID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.known[connID]
+}
+
+// clientErrorCounter counts reports by kind and rate-limits them per IP.
+type clientErrorCounter struct {
+	mu      sync.Mutex
+	janitor *janitor
+	byKind  map[string]uint64
+	perIP   map[string]int
+}
+
+func newClientErrorCounter(j *janitor) *clientErrorCounter {
+	return &clientErrorCounter{janitor: j, byKind: make(map[string]uint64), perIP: make(map[string]int)}
+}
+
+func (c *clientErrorCounter) allow(ip string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.perIP[ip] >= clientErrorsPerMinute {
+		return false
+	}
+	if c.perIP[ip] == 0 {
+		c.janitor.schedule("client-error-window", time.Minute, func() {
+			c.mu.Lock()
+			delete(c.perIP, ip)
+			c.mu.Unlock()
+		})
+	}
+	c.perIP[ip]++
+	return true
+}
+
+func (c *clientErrorCounter) count(kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.byKind[kind]; !ok && len(c.byKind) >= clientErrorKindLimit {
+		kind = "other"
+	}
+	c.byKind[kind]++
+}
+
+func (c *clientErrorCounter) snapshot() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]uint64, len(c.byKind))
+	for kind, n := range c.byKind {
+		counts[kind] = n
+	}
+	return counts
+}
+
+type clientErrorReport struct {
+	ConnectionID string          `json:"connectionId"`
+	Kind         string          `json:"kind"`
+	Detail       json.RawMessage `json:"detail"`
+	UserAgent    string          `json:"userAgent"`
+}
+
+func (h *Hub) handleClientErrors(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.clientErrors.allow(clientIP(r)) {
+		http.Error(w, "Too many reports", http.StatusTooManyRequests)
+		return
+	}
+
+	var report clientErrorReport
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, clientErrorBodyLimit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&report); err != nil {
+		http.Error(w, "Invalid report", http.StatusBadRequest)
+		return
+	}
+	if !clientErrorKind.MatchString(report.Kind) || len(report.UserAgent) > clientErrorUALimit {
+		http.Error(w, "Invalid report", http.StatusBadRequest)
+		return
+	}
+	if !h.connections.isKnown(report.ConnectionID) {
+		// Unknown or long-expired connection: accept silently but drop it.
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	detail := report.Detail
+	if len(detail) > clientErrorDetailLimit {
+		detail = detail[:clientErrorDetailLimit]
+	}
+	h.clientErrors.count(report.Kind)
+	h.usage.countError("client_report")
+	log.Printf("client error: conn=%s kind=%s ua=%q detail=%q", report.ConnectionID, report.Kind, report.UserAgent, detail)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Hub) handleClientErrorStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]map[string]uint64{"byKind": h.clientErrors.snapshot()})
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// lobbyPollInterval is how often clients are advised to refresh /rooms.
+const lobbyPollInterval = 3
+
+// protocolVersions lists the wire formats the server speaks on /ws.
+var protocolVersions = []int{1}
+
+// clientConfig is the public, secret-free document served at /config.json.
+// Every option that changes what a client may do or should expect belongs here.
+type clientConfig struct {
+	ProtocolVersions []int           `json:"protocolVersions"`
+	LobbyPollSeconds int             `json:"lobbyPollSeconds"`
+	Endpoints        clientEndpoints `json:"endpoints"`
+	Features         clientFeatures  `json:"features"`
+	Limits           clientLimits    `json:"limits"`
+}
+
+type clientEndpoints struct {
+	WebSocket string `json:"websocket"`
+	Preflight string `json:"preflight"`
+	Rooms     string `json:"rooms"`
+	Reserve   string `json:"reserve"`
+	Invite    string `json:"invite"`
+	Send      string `json:"send"`
+	RoomUsers string `json:"roomUsers"`
+	RoomLink  string `json:"roomLink,omitempty"`
+}
+
+// clientFeatures says which features this server offers. Each follows the
+// options that turn it off, if any, so a client never offers what would be
+// refused.
+type clientFeatures struct {
+	Frontend        bool `json:"frontend"`
+	RoomLinks       bool `json:"roomLinks"`
+	Reservations    bool `json:"reservations"`
+	Invites         bool `json:"invites"`
+	Whoami          bool `json:"whoami"`
+	DirectMessages  bool `json:"directMessages"`
+	MultiRoom       bool `json:"multiRoom"`
+	Replay          bool `json:"replay"`
+	WindowedHistory bool `json:"windowedHistory"`
+	APIKeys         bool `json:"apiKeys"`
+}
+
+type clientLimits struct {
+	JoinAttemptsPerMinute int     `json:"joinAttemptsPerMinute"`
+	MaxReservationSec     int64   `json:"maxReservationSeconds"`
+	ReservationsPerIP     int     `json:"reservationsPerIP"`
+	MessagesPerSecond     float64 `json:"messagesPerSecond"`
+	MessageBurst          int     `json:"messageBurst"`
+	MaxMessageBytes       int     `json:"maxMessageBytes"`
+	MaxUsernameLength     int     `json:"maxUsernameLength"`
+	MaxTopicLength        int     `json:"maxTopicLength"`
+}
+
+// currentClientConfig is built per request from the hub's options, so it
+// never goes stale relative to the running configuration.
+func (h *Hub) currentClientConfig() clientConfig {
+	profile := h.opts.startingProfile()
+	cfg := clientConfig{
+		ProtocolVersions: protocolVersions,
+		LobbyPollSeconds: lobbyPollInterval,
+		Endpoints: clientEndpoints{
+			WebSocket: "/ws",
+			Preflight: "/ws/preflight",
+			Rooms:     "/rooms",
+			Reserve:   "/rooms/reserve",
+			Invite:    "/rooms/invite",
+			Send:      "/rooms/send",
+			RoomUsers: "/rooms/{name}/users",
+		},
+		Features: clientFeatures{
+			Frontend:        !h.opts.NoStatic,
+			RoomLinks:       !h.opts.NoStatic,
+			Reservations:    h.opts.RoomsToken != "" || h.opts.RoomsOpen,
+			Invites:         true,
+			Whoami:          true,
+			DirectMessages:  true,
+			MultiRoom:       true,
+			Replay:          h.opts.ReplayBuffer > 0,
+			WindowedHistory: h.opts.ReplayBuffer > 0,
+			APIKeys:         h.opts.APIKeyRequests > 0,
+		},
+		Limits: clientLimits{
+			JoinAttemptsPerMinute: h.opts.JoinAttempts,
+			MaxReservationSec:     int64(h.opts.MaxReservation.Seconds()),
+			ReservationsPerIP:     h.opts.ReservationsPerIP,
+			MessagesPerSecond:     profile.Rate,
+			MessageBurst:          profile.Burst,
+			MaxMessageBytes:       h.opts.MaxMessageSize,
+			MaxUsernameLength:     h.opts.MaxUsernameLength,
+			MaxTopicLength:        maxTopicLength,
+		},
+	}
+	if cfg.Features.RoomLinks {
+		cfg.Endpoints.RoomLink = "/room/{name}"
+	}
+	return cfg
+}
+
+func (h *Hub) handleClientConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	json.NewEncoder(w).Encode(h.currentClientConfig())
+}
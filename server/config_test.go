@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clientOptions are the options /config.json reflects, each with a change
+// that must show in the document.
+var clientOptions = map[string]func(*Options){
+	"JoinAttempts":      func(o *Options) { o.JoinAttempts++ },
+	"MaxReservation":    func(o *Options) { o.MaxReservation += time.Hour },
+	"ReservationsPerIP": func(o *Options) { o.ReservationsPerIP++ },
+	"MsgRate":           func(o *Options) { o.MsgRate /= 2 },
+	"MsgBurst":          func(o *Options) { o.MsgBurst-- },
+	"RateProfile":       func(o *Options) { o.RateProfile = "strict" },
+	"MaxMessageSize":    func(o *Options) { o.MaxMessageSize++ },
+	"MaxUsernameLength": func(o *Options) { o.MaxUsernameLength++ },
+	"NoStatic":          func(o *Options) { o.NoStatic = !o.NoStatic },
+	"RoomsOpen":         func(o *Options) { o.RoomsOpen = !o.RoomsOpen },
+	"ReplayBuffer":      func(o *Options) { o.ReplayBuffer = 0 },
+	"APIKeyRequests":    func(o *Options) { o.APIKeyRequests = 0 },
+}
+
+// featureSwitches maps each /config.json feature to an option change that
+// turns it off, or to nil for a feature every server has.
+var featureSwitches = map[string]func(*Options){
+	"frontend":        func(o *Options) { o.NoStatic = true },
+	"roomLinks":       func(o *Options) { o.NoStatic = true },
+	"reservations":    func(o *Options) { o.RoomsToken, o.RoomsOpen = "", false },
+	"invites":         nil,
+	"whoami":          nil,
+	"directMessages":  nil,
+	"multiRoom":       nil,
+	"replay":          func(o *Options) { o.ReplayBuffer = 0 },
+	"windowedHistory": func(o *Options) { o.ReplayBuffer = 0 },
+	"apiKeys":         func(o *Options) { o.APIKeyRequests = 0 },
+}
+
+// serverOnlyOptions are the options deliberately left out of /config.json.
+// A new option goes in one list or the other.
+var serverOnlyOptions = []string{
+	"RoomsToken", "AllowedOrigins", "PublicURL",
+	"AdmitRate", "AdmitBurst", "AdmitWait", "AdmitQueue",
+	"MaxConnections", "ReservedProvisioned", "ReservedAdmin",
+	"PingInterval", "PongWait", "WriteWait", "SendBuffer",
+	"MaxMsgRate", "MaxMsgBurst", "RoomMsgRate", "RoomMsgBurst", "MsgStrikes",
+	"MaxReminders", "BanIPs", "LenientUsernames",
+	"StormLeaves", "StormWindow", "StormCooldown", "PresenceFlush",
+	"RoomIdleTTL", "RoomIdleCheck",
+	"RoomsConfig", "RoomsConfigCloseRemoved", "Persist",
+	"DailyReport", "DailyReportTZ", "DailyReportWebhook",
+	"StaticDir", "Frontend", "Debug", "LeakCheck",
+}
+
+func TestClientConfigCoversOptions(t *testing.T) {
+	serverOnly := make(map[string]bool)
+	for _, name := range serverOnlyOptions {
+		serverOnly[name] = true
+	}
+	fields := reflect.TypeFor[Options]()
+	for i := range fields.NumField() {
+		name := fields.Field(i).Name
+		_, client := clientOptions[name]
+		switch {
+		case client && serverOnly[name]:
+			t.Errorf("Options.%s is listed as both client and server-only", name)
+		case !client && !serverOnly[name]:
+			t.Errorf("Options.%s is in neither clientOptions nor serverOnlyOptions; decide whether /config.json shows it", name)
+		}
+	}
+
+	encode := func(opts Options) string {
+		data, _ := json.Marshal((&Hub{opts: opts}).currentClientConfig())
+		return string(data)
+	}
+	base := encode(DefaultOptions())
+	for name, change := range clientOptions {
+		opts := DefaultOptions()
+		change(&opts)
+		if encode(opts) == base {
+			t.Errorf("changing Options.%s does not change /config.json", name)
+		}
+	}
+}
+
+func TestClientConfigFeatures(t *testing.T) {
+	features := func(opts Options) map[string]bool {
+		data, _ := json.Marshal((&Hub{opts: opts}).currentClientConfig().Features)
+		var got map[string]bool
+		json.Unmarshal(data, &got)
+		return got
+	}
+	all := features(DefaultOptions())
+	if len(all) != reflect.TypeFor[clientFeatures]().NumField() {
+		t.Fatalf("/config.json lists %d features, want every clientFeatures field: %v", len(all), all)
+	}
+	for name, on := range all {
+		if _, ok := featureSwitches[name]; !ok {
+			t.Errorf("feature %q is not in featureSwitches", name)
+		}
+		if !on {
+			t.Errorf("feature %q is off under the default options", name)
+		}
+	}
+	for name, off := range featureSwitches {
+		if _, ok := all[name]; !ok {
+			t.Errorf("feature %q missing from /config.json", name)
+			continue
+		}
+		if off == nil {
+			continue
+		}
+		opts := DefaultOptions()
+		off(&opts)
+		if features(opts)[name] {
+			t.Errorf("feature %q still on with the option that disables it", name)
+		}
+	}
+}
+
+func TestConfigJSON(t *testing.T) {
+	s := newTestServer(t, func(o *Options) { o.MaxMessageSize = 1234 })
+	resp, err := http.Get(s.srv.URL + "/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	var cfg clientConfig
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Limits.MaxMessageBytes != 1234 || cfg.Endpoints.WebSocket != "/ws" {
+		t.Fatalf("config = %+v", cfg)
+	}
+}
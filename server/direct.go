@@ -0,0 +1,43 @@
+package server
+
+import (
+	"strings"
+
+	"chat/protocol"
+)
+
+// sendDirect delivers body to the member named to and echoes it back to the
+// sender. Direct messages never go through broadcastToRoom, so nothing that
+// records the room's broadcasts sees them.
+func (h *Hub) sendDirect(client *Client, to, body string) {
+	room := client.room
+	notice := func(text string) {
+		h.sendTo(client, newEnvelope(protocol.EventSystem, room, text).Encode())
+	}
+	target := room.lookupName(to)
+	switch {
+	case body == "":
+		notice("Usage: " + msgUsage)
+	case target == nil:
+		notice("No one named " + to + " is in this room.")
+	case target == client:
+		notice("You cannot send a private message to yourself.")
+	default:
+		data := directEnvelope(client, target, body).Encode()
+		// The target may have left since the lookup; sendTo checks again
+		// under the room lock.
+		if !h.sendTo(target, data) {
+			notice(target.nick() + " is no longer in this room.")
+			return
+		}
+		h.sendTo(client, data)
+	}
+}
+
+const msgUsage = "/msg username text"
+
+func (h *Hub) msgCommand(client *Client, arg string) string {
+	to, body, _ := strings.Cut(arg, " ")
+	h.sendDirect(client, to, strings.TrimSpace(body))
+	return ""
+}
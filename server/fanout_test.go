@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// fanOutAllocBudget is the most allocations one chat frame may cost from
+// arriving on a connection to being queued for every recipient. Fan-out
+// shares one encoded frame among recipients, so it holds for any room size.
+// Raise it only on purpose.
+const fanOutAllocBudget = 5
+
+// benchRoom is a room whose members have send queues but no sockets, each
+// queue drained in the background, so the hub's own cost is what gets
+// measured and no recipient is ever dropped as a slow consumer.
+type benchRoom struct {
+	h      *Hub
+	room   *Room
+	sender *Client
+	frame  []byte
+}
+
+// newBenchRoom joins a sender and recipients others to a room of their own,
+// on a hub that is not running: send does Run's part itself.
+func newBenchRoom(tb testing.TB, recipients int) *benchRoom {
+	tb.Helper()
+	opts := DefaultOptions()
+	opts.NoStatic = true
+	opts.DailyReport = tb.TempDir()
+	opts.MsgRate, opts.MaxMsgRate, opts.RoomMsgRate = 1e9, 1e9, 1e9
+	opts.MsgBurst, opts.MaxMsgBurst, opts.RoomMsgBurst = 1<<30, 1<<30, 1<<30
+	h, err := newHub(opts, newFakeClock())
+	if err != nil {
+		tb.Fatalf("newHub: %v", err)
+	}
+	room, _ := h.createRoom("bench", "", false, 0, false, "")
+	quit := make(chan struct{})
+	tb.Cleanup(func() { close(quit) })
+	var sender *Client
+	for i := range recipients + 1 {
+		c := &Client{
+			session: &session{id: h.nextClientID.Add(1), conn: &websocket.Conn{}, send: make(chan []byte, 1024), quit: make(chan struct{})},
+			room:    room,
+		}
+		c.limiter = newInboundLimiter(room, room.currentRateProfile(), h.opts.MsgStrikes)
+		room.reserve(c, fmt.Sprintf("user%d", i))
+		room.clients[c.conn] = c
+		go func() {
+			for {
+				select {
+				case <-c.send:
+				case <-quit:
+					return
+				}
+			}
+		}()
+		if i == 0 {
+			sender = c
+		}
+	}
+	b := &benchRoom{h: h, room: room, sender: sender, frame: []byte(`{"type":"chat","body":"the quick brown fox jumps over the lazy dog"}`)}
+	// A full replay buffer, so sequence evicts as it does in a busy room.
+	for range opts.ReplayBuffer {
+		b.send()
+	}
+	return b
+}
+
+// send takes the frame through what the read loop and Run do with a chat
+// message.
+func (b *benchRoom) send() {
+	frame, _ := protocol.ParseInbound(b.frame)
+	if b.sender.limiter.check(time.Now(), b.room.currentRateProfile()) != limitAllow {
+		panic("bench sender rate limited")
+	}
+	env := chatEnvelope(b.sender, sanitizeText(frame.Body))
+	b.h.deliver(&Message{room: b.room, senderID: b.sender.id, env: &env})
+}
+
+func BenchmarkFanOut(b *testing.B) {
+	for _, recipients := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("recipients=%d", recipients), func(b *testing.B) {
+			room := newBenchRoom(b, recipients)
+			b.ReportAllocs()
+			for b.Loop() {
+				room.send()
+			}
+		})
+	}
+}
+
+func TestFanOutAllocBudget(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+	for _, recipients := range []int{10, 1000} {
+		room := newBenchRoom(t, recipients)
+		// AllocsPerRun counts every goroutine's allocations, and goroutines
+		// left winding down by earlier tests can add a few; they only ever
+		// add, so the fewest of several runs is the send's own count.
+		allocs := testing.AllocsPerRun(100, room.send)
+		for range 4 {
+			allocs = min(allocs, testing.AllocsPerRun(100, room.send))
+		}
+		if allocs > fanOutAllocBudget {
+			t.Errorf("%d recipients: %.0f allocations per message, budget is %d", recipients, allocs, fanOutAllocBudget)
+		}
+	}
+}
+
+// TestSlowReaderDropped has a member that never reads: once its socket and
+// send buffer fill it is dropped with a notice, and the room carries on.
+func TestSlowReaderDropped(t *testing.T) {
+	s := newTestServer(t, func(o *Options) {
+		o.ReplayBuffer, o.SendBuffer = 0, 8
+		o.WriteWait = 100 * time.Millisecond
+		o.MsgRate, o.MaxMsgRate, o.RoomMsgRate = 1e6, 1e6, 1e6
+		o.MsgBurst, o.MaxMsgBurst, o.RoomMsgBurst = 1e6, 1e6, 1e6
+	})
+	sender, _ := s.join(t, "room=lobby&username=sender")
+	reader, _ := s.join(t, "room=lobby&username=reader")
+	dialer := websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		conn, err := net.Dial(network, addr)
+		if err == nil {
+			conn.(*net.TCPConn).SetReadBuffer(4096)
+		}
+		return conn, err
+	}}
+	stalled, _, err := dialer.Dial(s.wsURL("room=lobby&username=stalled"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	waitFor(t, "stalled to join", func() bool { return s.memberCount("lobby") == 3 })
+
+	filler := strings.Repeat("x", 3500)
+	for i := 0; ; i++ {
+		if i == 10000 {
+			t.Fatal("stalled member never dropped")
+		}
+		sender.send(fmt.Sprintf("%d %s", i, filler))
+		env, err := reader.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.Type == protocol.EventLeave {
+			if env.Body != "stalled disconnected (slow consumer)" {
+				t.Fatalf("got %s %q, want the slow consumer notice", env.Type, env.Body)
+			}
+			break
+		}
+	}
+	sender.send("still here")
+	for {
+		if env := reader.next(protocol.EventChat); env.Body == "still here" {
+			break
+		}
+	}
+	if n := s.memberCount("lobby"); n != 2 {
+		t.Fatalf("%d members left, want 2", n)
+	}
+}
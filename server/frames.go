@@ -0,0 +1,31 @@
+package server
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// readLimitFactor sets the hard read limit as a multiple of
+	// -max-message-size. Frames between the two are read, refused and
+	// counted; beyond it the connection is closed mid-frame.
+	readLimitFactor = 4
+	// oversizeStrikes is how many refused frames a connection may send
+	// before it is disconnected.
+	oversizeStrikes = 3
+)
+
+// sanitizeText turns line breaks and tabs into spaces and drops every other
+// control character, so nobody can start a fake line from someone else or
+// send terminal escapes.
+func sanitizeText(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+}
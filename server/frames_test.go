@@ -0,0 +1,27 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"chat/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestFrameSizeLimit(t *testing.T) {
+	s := newTestServer(t, func(o *Options) { o.MaxMessageSize = 64 })
+	alice, _ := s.join(t, "room=lobby&username=alice")
+	bob, _ := s.join(t, "room=lobby&username=bob")
+
+	alice.send(strings.Repeat("b", 65))
+	alice.nextSystem("over 64 bytes")
+	if err := alice.conn.WriteMessage(websocket.BinaryMessage, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	alice.nextSystem("Only text frames")
+	alice.send(strings.Repeat("a", 64))
+	if got := bob.next(protocol.EventChat); got.Body != strings.Repeat("a", 64) {
+		t.Fatalf("chat = %+v", got)
+	}
+}
@@ -0,0 +1,375 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"chat/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeClock is a clock tests move by hand, so janitor expiry runs without
+// sleeps.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{c.now.Add(d), ch})
+	return ch
+}
+
+// Advance moves the clock on by d and wakes every waiter now due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			kept = append(kept, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = kept
+}
+
+// testServer is a running hub behind an httptest server. Its janitor runs on
+// clock.
+type testServer struct {
+	*Hub
+	srv   *httptest.Server
+	clock *fakeClock
+}
+
+// newTestServer starts a hub with the default options, changed by configure
+// if given, and stops it when the test ends. Presence is sent unbatched so
+// tests see each join and leave as it happens.
+func newTestServer(t testing.TB, configure func(*Options)) *testServer {
+	t.Helper()
+	opts := DefaultOptions()
+	opts.NoStatic = true
+	opts.PresenceFlush = 0
+	if configure != nil {
+		configure(&opts)
+	}
+	clock := newFakeClock()
+	h, err := newHub(opts, clock)
+	if err != nil {
+		t.Fatalf("newHub: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(done)
+	}()
+	mux := http.NewServeMux()
+	h.Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		drainCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+		defer stop()
+		h.Drain(drainCtx)
+		cancel()
+		<-done
+		srv.Close()
+	})
+	return &testServer{Hub: h, srv: srv, clock: clock}
+}
+
+func (s *testServer) wsURL(query string) string {
+	return "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/ws?" + query
+}
+
+// testConn is one websocket client of a testServer.
+type testConn struct {
+	t    testing.TB
+	conn *websocket.Conn
+}
+
+// dial joins with query and fails the test if the upgrade is refused.
+func (s *testServer) dial(t testing.TB, query string) *testConn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(s.wsURL(query), nil)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial %s: %v (status %d)", query, err, status)
+	}
+	c := &testConn{t: t, conn: conn}
+	t.Cleanup(func() { conn.Close() })
+	return c
+}
+
+// dialStatus attempts a join with query that is expected to be refused and
+// returns the status of the refusal.
+func (s *testServer) dialStatus(t testing.TB, query string) int {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(s.wsURL(query), nil)
+	if err == nil {
+		conn.Close()
+		t.Fatalf("dial %s: upgrade succeeded, want it refused", query)
+	}
+	if resp == nil {
+		t.Fatalf("dial %s: %v", query, err)
+	}
+	return resp.StatusCode
+}
+
+// join dials query and reads up to the hello event.
+func (s *testServer) join(t testing.TB, query string) (*testConn, protocol.Envelope) {
+	t.Helper()
+	c := s.dial(t, query)
+	return c, c.next(protocol.EventHello)
+}
+
+func (c *testConn) read() (protocol.Envelope, error) {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return protocol.Envelope{}, err
+	}
+	var env protocol.Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		c.t.Fatalf("decode %s: %v", data, err)
+	}
+	return env, nil
+}
+
+// next returns the next event of type eventType, skipping others.
+func (c *testConn) next(eventType string) protocol.Envelope {
+	c.t.Helper()
+	for {
+		env, err := c.read()
+		if err != nil {
+			c.t.Fatalf("waiting for %s event: %v", eventType, err)
+		}
+		if env.Type == eventType {
+			return env
+		}
+	}
+}
+
+// nextSystem returns the next system event whose body contains text.
+func (c *testConn) nextSystem(text string) protocol.Envelope {
+	c.t.Helper()
+	for {
+		env := c.next(protocol.EventSystem)
+		if strings.Contains(env.Body, text) {
+			return env
+		}
+	}
+}
+
+// closed waits for the server to close the connection and returns the close
+// code.
+func (c *testConn) closed() int {
+	c.t.Helper()
+	for {
+		_, err := c.read()
+		if err == nil {
+			continue
+		}
+		var ce *websocket.CloseError
+		if errors.As(err, &ce) {
+			return ce.Code
+		}
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			c.t.Fatalf("connection still open")
+		}
+		return websocket.CloseAbnormalClosure
+	}
+}
+
+func (c *testConn) send(text string) {
+	c.t.Helper()
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte(text)); err != nil {
+		c.t.Fatalf("send: %v", err)
+	}
+}
+
+func (c *testConn) sendFrame(frame protocol.Inbound) {
+	c.t.Helper()
+	c.send(string(frame.Encode()))
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (h *Hub) memberCount(name string) int {
+	room := h.getRoom(name)
+	if room == nil {
+		return 0
+	}
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	return len(room.clients)
+}
+
+func TestNewHubRejectsInvalidOptions(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PongWait = opts.PingInterval
+	if _, err := NewHub(opts); err == nil {
+		t.Fatal("NewHub accepted -pong-wait equal to -ping-interval")
+	}
+}
+
+func TestHandleRoomsWithoutListener(t *testing.T) {
+	h, err := NewHub(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.createRoom("open", "", false, 0, false, "")
+	h.createRoom("hidden", "", true, 0, false, "")
+
+	rec := httptest.NewRecorder()
+	h.HandleRooms(rec, httptest.NewRequest("GET", "/rooms", nil))
+	var body struct{ Rooms []struct{ Name string } }
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Rooms) != 1 || body.Rooms[0].Name != "open" {
+		t.Fatalf("rooms = %+v, want only the public room", body.Rooms)
+	}
+}
+
+func TestJoinChatAndLeave(t *testing.T) {
+	s := newTestServer(t, nil)
+	alice, hello := s.join(t, "room=lobby&username=alice")
+	if hello.Sender != "alice" || hello.Room != "lobby" {
+		t.Fatalf("hello = %+v", hello)
+	}
+	alice.next(protocol.EventJoin)
+	bob, _ := s.join(t, "room=lobby&username=bob")
+	if got := alice.next(protocol.EventJoin); got.Sender != "bob" {
+		t.Fatalf("join event names %q, want bob", got.Sender)
+	}
+
+	alice.send("hi bob")
+	if got := bob.next(protocol.EventChat); got.Body != "hi bob" || got.Sender != "alice" || got.Seq != 1 {
+		t.Fatalf("chat = %+v", got)
+	}
+
+	bob.conn.Close()
+	if got := alice.next(protocol.EventLeave); got.Sender != "bob" || *got.UserCount != 1 {
+		t.Fatalf("leave = %+v", got)
+	}
+	alice.conn.Close()
+	waitFor(t, "the empty room to be removed", func() bool { return s.getRoom("lobby") == nil })
+}
+
+// TestFramesCarryOnlyPublicIDs checks the ids in hello, roster and join
+// frames against the room's public ids: each must be one, and none may be
+// the internal counter behind Message.senderID and the logs.
+func TestFramesCarryOnlyPublicIDs(t *testing.T) {
+	s := newTestServer(t, nil)
+	alice, aliceHello := s.join(t, "room=lobby&username=alice")
+	alice.next(protocol.EventJoin)
+	_, bobHello := s.join(t, "room=lobby&username=bob")
+	bobJoin := alice.next(protocol.EventJoin)
+
+	room := s.getRoom("lobby")
+	public := map[string]string{}
+	internal := map[string]bool{}
+	room.mu.RLock()
+	for _, c := range room.clients {
+		public[c.nick()] = c.publicID
+		internal[strconv.FormatUint(c.id, 10)] = true
+	}
+	room.mu.RUnlock()
+
+	check := func(frame, name, id string) {
+		t.Helper()
+		if internal[id] || !publicIDPattern.MatchString(id) {
+			t.Errorf("%s: %s has id %q, want a public id", frame, name, id)
+		}
+		if id != public[name] {
+			t.Errorf("%s: %s has id %q, want %q", frame, name, id, public[name])
+		}
+	}
+	check("alice's hello", "alice", aliceHello.SenderID)
+	check("bob's hello", "bob", bobHello.SenderID)
+	check("bob's join", "bob", bobJoin.SenderID)
+	if len(bobHello.Members) != 2 {
+		t.Fatalf("roster lists %d members, want 2", len(bobHello.Members))
+	}
+	for _, m := range bobHello.Members {
+		check("roster", m.Name, m.ID)
+	}
+}
+
+// publicIDPattern is what newPublicID returns: 8 characters of lower-case
+// base32.
+var publicIDPattern = regexp.MustCompile(`^[a-z2-7]{8}$`)
+
+func TestSenderNotEchoed(t *testing.T) {
+	s := newTestServer(t, nil)
+	alice, _ := s.join(t, "room=lobby&username=alice")
+	bob, _ := s.join(t, "room=lobby&username=bob")
+	carol, _ := s.join(t, "room=lobby&username=carol&echo=true")
+
+	alice.send("one")
+	for _, c := range []*testConn{bob, carol} {
+		if got := c.next(protocol.EventChat); got.Body != "one" {
+			t.Fatalf("chat = %+v", got)
+		}
+	}
+	bob.send("two")
+	if got := alice.next(protocol.EventChat); got.Body != "two" {
+		t.Fatalf("alice got %q first, want bob's message and not her own", got.Body)
+	}
+	carol.send("three")
+	carol.next(protocol.EventChat) // bob's
+	if got := carol.next(protocol.EventChat); got.Body != "three" || got.Sender != "carol" {
+		t.Fatalf("echo=true: chat = %+v, want carol's own message back", got)
+	}
+}
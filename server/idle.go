@@ -0,0 +1,48 @@
+package server
+
+import (
+	"log"
+	"time"
+)
+
+func (r *Room) touch(now time.Time) {
+	r.lastActivity.Store(now.UnixNano())
+}
+
+func (r *Room) idleSince() time.Time {
+	return time.Unix(0, r.lastActivity.Load())
+}
+
+// scheduleIdleSweep expires idle rooms every -room-idle-check. Provisioned
+// rooms are meant to stay and are left alone. Closing rooms waits on Run,
+// so sweeps run on their own goroutine rather than the janitor's, and the
+// next is scheduled once one is done.
+func (h *Hub) scheduleIdleSweep() {
+	h.janitor.schedule("room-idle", h.opts.RoomIdleCheck, func() {
+		cutoff := h.janitor.clock.Now().Add(-h.opts.RoomIdleTTL)
+		h.spawn("hub.idle", func() {
+			h.expireIdleRooms(cutoff)
+			h.scheduleIdleSweep()
+		})
+	})
+}
+
+// expireIdleRooms closes every room idle since before cutoff. Rooms are
+// collected first so no shard lock is held while members are notified.
+func (h *Hub) expireIdleRooms(cutoff time.Time) {
+	var idle []*Room
+	h.rooms.each(func(room *Room) {
+		room.mu.RLock()
+		defer room.mu.RUnlock()
+		if !room.provisioned && room.idleSince().Before(cutoff) {
+			idle = append(idle, room)
+		}
+	})
+	for _, room := range idle {
+		log.Printf("room=%q expired after %v idle", room.name, h.janitor.clock.Now().Sub(room.idleSince()).Round(time.Second))
+		h.closeRoom(room, "This room expired after being idle.", "room expired")
+		// Rooms left without members are dropped now; the rest go as
+		// their members' read loops unregister.
+		h.removeRoom(room.name)
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultInviteTTL = 24 * time.Hour
+	maxInviteTTL     = 7 * 24 * time.Hour
+	inviteUsage      = "/invite [reusable] [DURATION], e.g. /invite reusable 2h"
+)
+
+var invalidInvite = &joinError{http.StatusForbidden, "invalid_invite", "Invite is invalid, expired or already used"}
+
+// invite lets whoever holds its token into a room without the password. A
+// single-use invite is spent by its first join; a reusable one lasts until it
+// expires.
+type invite struct {
+	until    time.Time
+	reusable bool
+}
+
+// addInvite mints an invite valid until until. Invites live on the room, so
+// they go when it does.
+func (h *Hub) addInvite(room *Room, until time.Time, reusable bool) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+	sum := sha256.Sum256([]byte(token))
+	room.mu.Lock()
+	if room.invites == nil {
+		room.invites = make(map[[sha256.Size]byte]*invite)
+	}
+	inv := &invite{until: until, reusable: reusable}
+	room.invites[sum] = inv
+	room.mu.Unlock()
+	h.janitor.schedule("invite", time.Until(until), func() {
+		room.mu.Lock()
+		if room.invites[sum] == inv {
+			delete(room.invites, sum)
+		}
+		room.mu.Unlock()
+	})
+	return token, nil
+}
+
+// validInvite reports whether token opens r now.
+func (r *Room) validInvite(token string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	inv := r.invites[sha256.Sum256([]byte(token))]
+	return inv != nil && time.Now().Before(inv.until)
+}
+
+// useInvite spends token and reports whether it was still good, so of two
+// joins racing on a single-use invite only one gets in.
+func (r *Room) useInvite(token string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sum := sha256.Sum256([]byte(token))
+	inv := r.invites[sum]
+	if inv == nil || !time.Now().Before(inv.until) {
+		return false
+	}
+	if !inv.reusable {
+		delete(r.invites, sum)
+	}
+	return true
+}
+
+// inviteLink is the frontend path that joins room with token.
+func inviteLink(room, token string) string {
+	return "/?" + url.Values{"room": {room}, "invite": {token}}.Encode()
+}
+
+// inviteCommand gives the owner an invite to the room: single-use unless
+// reusable is given, valid for DURATION or a day.
+func (h *Hub) inviteCommand(client *Client, arg string) string {
+	fields := strings.Fields(arg)
+	reusable := len(fields) > 0 && fields[0] == "reusable"
+	if reusable {
+		fields = fields[1:]
+	}
+	ttl := defaultInviteTTL
+	switch len(fields) {
+	case 0:
+	case 1:
+		d, err := time.ParseDuration(fields[0])
+		if err != nil {
+			return "Usage: " + inviteUsage
+		}
+		ttl = d
+	default:
+		return "Usage: " + inviteUsage
+	}
+	if ttl < time.Minute || ttl > maxInviteTTL {
+		return fmt.Sprintf("Invites must last from %v to %v.", time.Minute, maxInviteTTL)
+	}
+	room := client.room
+	until := time.Now().Add(ttl)
+	token, err := h.addInvite(room, until, reusable)
+	if err != nil {
+		return "Failed to create an invite."
+	}
+	log.Printf("room=%q invite created by %q until %s", room.name, client.nick(), until.UTC().Format(time.RFC3339))
+	kind := "Single-use invite"
+	if reusable {
+		kind = "Invite"
+	}
+	return kind + ", valid until " + until.UTC().Format("Jan 2 15:04 MST") + ": " + inviteLink(room.name, token)
+}
+
+type inviteRequest struct {
+	Room     string    `json:"room"`
+	Until    time.Time `json:"until"`
+	Reusable bool      `json:"reusable"`
+}
+
+type inviteResponse struct {
+	Room     string    `json:"room"`
+	Token    string    `json:"token"`
+	Link     string    `json:"link"`
+	Until    time.Time `json:"until"`
+	Reusable bool      `json:"reusable"`
+}
+
+// handleInvite serves POST /rooms/invite, minting an invite to an existing
+// room for holders of the rooms token. An invite gets past the room's
+// password, so unlike the listing this is refused when no token is set, even
+// with -rooms-open; owners mint invites with /invite or with an API key
+// holding the invite scope instead.
+func (h *Hub) handleInvite(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.opts.RoomsToken == "" {
+		http.Error(w, "Minting invites needs -rooms-token", http.StatusForbidden)
+		return
+	}
+	if !h.checkRoomsToken(w, r) {
+		return
+	}
+
+	req, ok := decodeInviteRequest(w, r)
+	if !ok {
+		return
+	}
+	room := h.getRoom(strings.TrimSpace(req.Room))
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	h.writeInvite(w, room, req, "/rooms/invite")
+}
+
+// handleRoomInvite serves POST /rooms/{name}/invites for API keys with the
+// invite scope, taking the same body as /rooms/invite less the room.
+func (h *Hub) handleRoomInvite(w http.ResponseWriter, r *http.Request, room *Room, key *apiKey) {
+	req, ok := decodeInviteRequest(w, r)
+	if !ok {
+		return
+	}
+	h.writeInvite(w, room, req, "api key "+key.name)
+}
+
+// decodeInviteRequest reads an invite request, defaulting until to a day from
+// now, and writes the error response if it is invalid.
+func decodeInviteRequest(w http.ResponseWriter, r *http.Request) (inviteRequest, bool) {
+	var req inviteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	now := time.Now()
+	if req.Until.IsZero() {
+		req.Until = now.Add(defaultInviteTTL)
+	}
+	switch {
+	case !req.Until.After(now):
+		http.Error(w, "until must be in the future", http.StatusBadRequest)
+		return req, false
+	case req.Until.Sub(now) > maxInviteTTL:
+		http.Error(w, "Invite window is too long", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+func (h *Hub) writeInvite(w http.ResponseWriter, room *Room, req inviteRequest, via string) {
+	token, err := h.addInvite(room, req.Until, req.Reusable)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("room=%q invite created via %s until %s", room.name, via, req.Until.UTC().Format(time.RFC3339))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(inviteResponse{Room: room.name, Token: token, Link: inviteLink(room.name, token), Until: req.Until, Reusable: req.Reusable})
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/protocol"
+)
+
+const testRoomsToken = "rooms-secret"
+
+func withRoomsToken(o *Options) { o.RoomsToken = testRoomsToken }
+
+// postInvite asks /rooms/invite for an invite with body, authorized by token,
+// and returns the status and the token minted.
+func (s *testServer) postInvite(t *testing.T, token, body string) (int, string) {
+	t.Helper()
+	resp, err := http.Post(s.srv.URL+"/rooms/invite?token="+url.QueryEscape(token), "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var inv inviteResponse
+	json.NewDecoder(resp.Body).Decode(&inv)
+	return resp.StatusCode, inv.Token
+}
+
+// passwordRoom creates room with password, kept open by its owner's
+// connection.
+func (s *testServer) passwordRoom(t *testing.T, room string) *testConn {
+	t.Helper()
+	owner, _ := s.join(t, "action=create&room="+room+"&password=hunter2&username=owner")
+	return owner
+}
+
+func TestInviteNeedsRoomsToken(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.passwordRoom(t, "vault")
+	if status, _ := s.postInvite(t, "", `{"room":"vault"}`); status != http.StatusForbidden {
+		t.Fatalf("open server minted an invite: status %d, want 403", status)
+	}
+	if status := s.dialStatus(t, "room=vault&username=mallory"); status != http.StatusUnauthorized {
+		t.Fatalf("join without password: status %d, want 401", status)
+	}
+
+	s = newTestServer(t, withRoomsToken)
+	s.passwordRoom(t, "vault")
+	if status, _ := s.postInvite(t, "wrong", `{"room":"vault"}`); status != http.StatusUnauthorized {
+		t.Fatalf("wrong token: status %d, want 401", status)
+	}
+	if status, token := s.postInvite(t, testRoomsToken, `{"room":"vault"}`); status != http.StatusCreated || token == "" {
+		t.Fatalf("rooms token: status %d token %q, want 201 and a token", status, token)
+	}
+}
+
+func TestInviteSingleUse(t *testing.T) {
+	s := newTestServer(t, withRoomsToken)
+	s.passwordRoom(t, "vault")
+	_, token := s.postInvite(t, testRoomsToken, `{"room":"vault"}`)
+
+	_, hello := s.join(t, "room=vault&username=guest&invite="+token)
+	if hello.Room != "vault" {
+		t.Fatalf("hello = %+v", hello)
+	}
+	if status := s.dialStatus(t, "room=vault&username=second&invite="+token); status != http.StatusForbidden {
+		t.Fatalf("reused single-use invite: status %d, want 403", status)
+	}
+}
+
+func TestInviteReusable(t *testing.T) {
+	s := newTestServer(t, withRoomsToken)
+	s.passwordRoom(t, "vault")
+	_, token := s.postInvite(t, testRoomsToken, `{"room":"vault","reusable":true}`)
+	s.join(t, "room=vault&username=first&invite="+token)
+	s.join(t, "room=vault&username=second&invite="+token)
+}
+
+func TestInviteExpires(t *testing.T) {
+	s := newTestServer(t, withRoomsToken)
+	s.passwordRoom(t, "vault")
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	_, token := s.postInvite(t, testRoomsToken, `{"room":"vault","reusable":true,"until":"`+until+`"}`)
+	s.join(t, "room=vault&username=early&invite="+token)
+
+	room := s.getRoom("vault")
+	waitFor(t, "the invite to expire", func() bool {
+		s.clock.Advance(2 * time.Hour)
+		return !room.validInvite(token)
+	})
+	if status := s.dialStatus(t, "room=vault&username=late&invite="+token); status != http.StatusForbidden {
+		t.Fatalf("expired invite: status %d, want 403", status)
+	}
+}
+
+func TestInviteToDeletedRoom(t *testing.T) {
+	s := newTestServer(t, withRoomsToken)
+	owner := s.passwordRoom(t, "vault")
+	_, token := s.postInvite(t, testRoomsToken, `{"room":"vault","reusable":true}`)
+	owner.conn.Close()
+	waitFor(t, "the room to be removed", func() bool { return s.getRoom("vault") == nil })
+
+	if status := s.dialStatus(t, "room=vault&username=late&invite="+token); status != http.StatusForbidden {
+		t.Fatalf("invite to a removed room: status %d, want 403", status)
+	}
+	if s.getRoom("vault") != nil {
+		t.Fatal("an invite to a removed room created it again")
+	}
+}
+
+func TestInviteCommand(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner := s.passwordRoom(t, "vault")
+	owner.send("/invite")
+	reply := owner.nextSystem("Single-use invite")
+	link, err := url.Parse(reply.Body[strings.Index(reply.Body, "/?"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.join(t, "room=vault&username=guest&invite="+link.Query().Get("invite"))
+
+	guest, _ := s.join(t, "room=vault&username=visitor&password=hunter2")
+	guest.send("/invite")
+	guest.nextSystem("Only the room owner")
+}
+
+func TestInviteByAPIKey(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner := s.passwordRoom(t, "vault")
+	owner.sendFrame(protocol.Inbound{Type: protocol.TypeCreateAPIKey, Name: "inviter", Scopes: []string{"invite"}})
+	secret := owner.next(protocol.EventAPIKey).Body
+
+	req, _ := http.NewRequest("POST", s.srv.URL+"/rooms/vault/invites", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+secret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var inv inviteResponse
+	json.NewDecoder(resp.Body).Decode(&inv)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("status %d, want 201", resp.StatusCode)
+	}
+	s.join(t, "room=vault&username=guest&invite="+inv.Token)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// clock abstracts time for the janitor so expiry can be driven without sleeps.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// janitorEntry is the handle returned by schedule; pass it to cancel.
+type janitorEntry struct {
+	deadline time.Time
+	category string
+	fn       func()
+	index    int
+}
+
+type janitorQueue []*janitorEntry
+
+func (q janitorQueue) Len() int           { return len(q) }
+func (q janitorQueue) Less(i, j int) bool { return q[i].deadline.Before(q[j].deadline) }
+func (q janitorQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *janitorQueue) Push(x any) {
+	entry := x.(*janitorEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+func (q *janitorQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	entry.index = -1
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// janitor runs every TTL-based expiry in the server from one goroutine.
+// Callbacks run on that goroutine and must not block.
+type janitor struct {
+	clock   clock
+	mu      sync.Mutex
+	queue   janitorQueue
+	expired map[string]uint64
+	wake    chan struct{}
+}
+
+func newJanitor(c clock) *janitor {
+	return &janitor{
+		clock:   c,
+		expired: make(map[string]uint64),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+func (j *janitor) schedule(category string, after time.Duration, fn func()) *janitorEntry {
+	entry := &janitorEntry{deadline: j.clock.Now().Add(after), category: category, fn: fn}
+	j.mu.Lock()
+	heap.Push(&j.queue, entry)
+	first := entry.index == 0
+	j.mu.Unlock()
+	if first {
+		j.poke()
+	}
+	return entry
+}
+
+// reschedule moves a pending entry to a new deadline, or schedules it again
+// if it already fired or was cancelled.
+func (j *janitor) reschedule(entry *janitorEntry, after time.Duration) {
+	j.mu.Lock()
+	entry.deadline = j.clock.Now().Add(after)
+	if entry.index >= 0 && entry.index < len(j.queue) && j.queue[entry.index] == entry {
+		heap.Fix(&j.queue, entry.index)
+	} else {
+		heap.Push(&j.queue, entry)
+	}
+	j.mu.Unlock()
+	j.poke()
+}
+
+// cancel removes a pending entry; it reports false if the entry already ran.
+func (j *janitor) cancel(entry *janitorEntry) bool {
+	if entry == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if entry.index < 0 || entry.index >= len(j.queue) || j.queue[entry.index] != entry {
+		return false
+	}
+	heap.Remove(&j.queue, entry.index)
+	return true
+}
+
+func (j *janitor) poke() {
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+}
+
+// due pops every entry whose deadline has passed, so a large clock jump
+// expires everything in one batch.
+func (j *janitor) due() ([]*janitorEntry, time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.clock.Now()
+	var ready []*janitorEntry
+	for len(j.queue) > 0 && !j.queue[0].deadline.After(now) {
+		entry := heap.Pop(&j.queue).(*janitorEntry)
+		j.expired[entry.category]++
+		ready = append(ready, entry)
+	}
+	wait := time.Duration(-1)
+	if len(j.queue) > 0 {
+		wait = j.queue[0].deadline.Sub(now)
+	}
+	return ready, wait
+}
+
+// run fires entries as they come due until ctx is done.
+func (j *janitor) run(ctx context.Context) {
+	for {
+		ready, wait := j.due()
+		for _, entry := range ready {
+			entry.fn()
+		}
+		if len(ready) > 0 {
+			continue
+		}
+		var timer <-chan time.Time
+		if wait >= 0 {
+			timer = j.clock.After(wait)
+		}
+		select {
+		case <-timer:
+		case <-j.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type janitorStats struct {
+	Pending int               `json:"pending"`
+	Expired map[string]uint64 `json:"expired"`
+}
+
+func (j *janitor) stats() janitorStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	expired := make(map[string]uint64, len(j.expired))
+	for category, n := range j.expired {
+		expired[category] = n
+	}
+	return janitorStats{Pending: len(j.queue), Expired: expired}
+}
+
+func (h *Hub) handleJanitor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.janitor.stats())
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"chat/protocol"
+)
+
+// fire runs every entry due on j's clock and returns how many there were.
+func fire(j *janitor) int {
+	ready, _ := j.due()
+	for _, entry := range ready {
+		entry.fn()
+	}
+	return len(ready)
+}
+
+// pending counts the entries of category waiting to fire.
+func (j *janitor) pending(category string) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	n := 0
+	for _, entry := range j.queue {
+		if entry.category == category {
+			n++
+		}
+	}
+	return n
+}
+
+func TestJanitorCancel(t *testing.T) {
+	clock := newFakeClock()
+	j := newJanitor(clock)
+	ran := false
+	entry := j.schedule("test", time.Minute, func() { ran = true })
+	if !j.cancel(entry) {
+		t.Fatal("cancel of a pending entry reported false")
+	}
+	clock.Advance(time.Hour)
+	if fire(j) != 0 || ran {
+		t.Fatal("a cancelled entry ran")
+	}
+	if j.cancel(entry) {
+		t.Fatal("second cancel reported true")
+	}
+}
+
+func TestJanitorReschedule(t *testing.T) {
+	clock := newFakeClock()
+	j := newJanitor(clock)
+	runs := 0
+	entry := j.schedule("test", time.Minute, func() { runs++ })
+	j.reschedule(entry, time.Hour)
+	clock.Advance(2 * time.Minute)
+	if fire(j) != 0 {
+		t.Fatal("entry ran at its old deadline")
+	}
+	clock.Advance(time.Hour)
+	if fire(j) != 1 || runs != 1 {
+		t.Fatalf("runs = %d, want 1", runs)
+	}
+	// An entry that already ran is scheduled again.
+	j.reschedule(entry, time.Minute)
+	clock.Advance(time.Minute)
+	if fire(j) != 1 || runs != 2 {
+		t.Fatalf("runs = %d, want 2", runs)
+	}
+}
+
+func TestJanitorClockJumpExpiresAll(t *testing.T) {
+	clock := newFakeClock()
+	j := newJanitor(clock)
+	const entries = 1000
+	for i := range entries {
+		j.schedule("test", time.Duration(i+1)*time.Second, func() {})
+	}
+	clock.Advance(24 * time.Hour)
+	if n := fire(j); n != entries {
+		t.Fatalf("%d entries expired in one batch, want %d", n, entries)
+	}
+	if stats := j.stats(); stats.Pending != 0 || stats.Expired["test"] != entries {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestIdleRoomExpires(t *testing.T) {
+	s := newTestServer(t, func(o *Options) {
+		o.RoomIdleTTL = time.Hour
+		o.RoomIdleCheck = time.Minute
+	})
+	alice, _ := s.join(t, "room=lobby&username=alice")
+	bob, _ := s.join(t, "room=lobby&username=bob")
+	s.clock.Advance(30 * time.Minute)
+	alice.send("still here")
+	bob.next(protocol.EventChat)
+
+	s.clock.Advance(45 * time.Minute)
+	if s.getRoom("lobby") == nil {
+		t.Fatal("room expired within -room-idle-ttl of its last message")
+	}
+	waitFor(t, "the idle room to expire", func() bool {
+		s.clock.Advance(time.Minute)
+		return s.getRoom("lobby") == nil
+	})
+	if got := alice.nextSystem("expired"); got.Room != "lobby" {
+		t.Fatalf("expiry notice = %+v", got)
+	}
+	alice.closed()
+	bob.closed()
+}
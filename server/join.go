@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const joinAttemptWindow = time.Minute
+
+// joinRequest holds the handshake parameters shared by /ws and /ws/preflight.
+type joinRequest struct {
+	room        string
+	username    string
+	action      string
+	password    string
+	private     bool
+	reservation string
+	// owner is the password of a configured owner joining under their name,
+	// or the owner code of whoever created or reserved the room.
+	owner    string
+	invite   string
+	capacity int
+	echo     bool
+	// replay asks for the chat frames numbered after since, in history
+	// windows if windowed.
+	replay   bool
+	windowed bool
+	since    uint64
+	// requireUsername asks a created room to turn away unnamed guests.
+	requireUsername bool
+	topic           string
+	ip              string
+}
+
+func parseJoinRequest(r *http.Request) joinRequest {
+	q := r.URL.Query()
+	req := joinRequest{
+		room:            q.Get("room"),
+		username:        strings.TrimSpace(sanitizeText(q.Get("username"))),
+		action:          q.Get("action"),
+		password:        q.Get("password"),
+		private:         q.Get("private") == "true",
+		reservation:     q.Get("reservation"),
+		owner:           q.Get("owner"),
+		invite:          q.Get("invite"),
+		echo:            q.Get("echo") == "true",
+		requireUsername: q.Get("requireUsername") == "true",
+		topic:           strings.TrimSpace(sanitizeText(q.Get("topic"))),
+		ip:              clientIP(r),
+	}
+	if since, err := strconv.ParseUint(q.Get("since"), 10, 64); err == nil {
+		req.replay, req.since = true, since
+		req.windowed = q.Get("history") == "windowed"
+	}
+	if max := q.Get("max"); max != "" {
+		n, err := strconv.Atoi(max)
+		if err != nil || n < 0 {
+			n = -1
+		}
+		req.capacity = n
+	}
+	if req.room == "" {
+		req.room = "default"
+	}
+	return req
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// joinError is a rejected handshake; code is stable for clients to switch on.
+type joinError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+func (e *joinError) write(w http.ResponseWriter) {
+	http.Error(w, e.Message, e.Status)
+}
+
+var usernameRequired = &joinError{http.StatusForbidden, "username_required", "This room requires a username"}
+
+// checkJoin runs every pre-upgrade validation without side effects beyond
+// counting failed password attempts. Both handleWebSocket and the preflight
+// endpoint go through it so their answers cannot diverge.
+func (h *Hub) checkJoin(req joinRequest) *joinError {
+	if h.attempts.blocked(req.ip) {
+		return &joinError{http.StatusTooManyRequests, "too_many_attempts", "Too many attempts, try again later"}
+	}
+	username, jerr := h.joinUsername(req.username)
+	if jerr != nil {
+		return jerr
+	}
+	room := h.getRoom(req.room)
+	if req.invite != "" && req.action != "create" {
+		// An invite never creates its room, even one since removed.
+		if room == nil || !room.validInvite(req.invite) {
+			h.attempts.fail(req.ip)
+			return invalidInvite
+		}
+	}
+	if room == nil {
+		// Joining a missing room creates it, so both paths honor reservations.
+		if jerr := h.reservations.check(req.room, req.reservation); jerr != nil {
+			return jerr
+		}
+	}
+	if req.action == "create" {
+		if room != nil {
+			return &joinError{http.StatusConflict, "room_exists", "Room already exists"}
+		}
+		if req.capacity < 0 {
+			return &joinError{http.StatusBadRequest, "invalid_capacity", "Room capacity must be a whole number, 0 for unlimited"}
+		}
+		if req.requireUsername && username == "" {
+			return usernameRequired
+		}
+		if utf8.RuneCountInString(req.topic) > maxTopicLength {
+			return &joinError{http.StatusBadRequest, "invalid_topic", topicTooLong}
+		}
+		return nil
+	}
+	if room != nil && req.invite == "" && !h.checkRoomPassword(req.room, username, req.password) {
+		h.attempts.fail(req.ip)
+		return &joinError{http.StatusUnauthorized, "invalid_password", "Invalid password"}
+	}
+	if room != nil && req.owner != "" && !room.claimsOwnership(username, req.owner, false) {
+		h.attempts.fail(req.ip)
+		return &joinError{http.StatusUnauthorized, "invalid_owner", "Invalid owner name or password"}
+	}
+	if room != nil && username == "" && room.requiresUsername() {
+		return usernameRequired
+	}
+	if room != nil && room.banned(username, req.ip) {
+		return &joinError{http.StatusForbidden, "banned", "You are banned from this room"}
+	}
+	if room != nil && room.full() {
+		return &joinError{http.StatusForbidden, "room_full", "Room is full"}
+	}
+	return nil
+}
+
+func (r *Room) requiresUsername() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.requireUsername
+}
+
+type attemptLimiter struct {
+	mu       sync.Mutex
+	janitor  *janitor
+	limit    int
+	failures map[string]int
+}
+
+func newAttemptLimiter(j *janitor, limit int) *attemptLimiter {
+	return &attemptLimiter{janitor: j, limit: limit, failures: make(map[string]int)}
+}
+
+func (l *attemptLimiter) blocked(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.failures[ip] >= l.limit
+}
+
+// fail counts a failed attempt. The first failure opens a window that the
+// janitor closes joinAttemptWindow later.
+func (l *attemptLimiter) fail(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failures[ip] == 0 {
+		l.janitor.schedule("join-attempts", joinAttemptWindow, func() {
+			l.mu.Lock()
+			delete(l.failures, ip)
+			l.mu.Unlock()
+		})
+	}
+	l.failures[ip]++
+}
+
+type preflightResult struct {
+	OK bool `json:"ok"`
+	*joinError
+}
+
+func (h *Hub) HandlePreflight(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	result := preflightResult{joinError: h.checkJoin(parseJoinRequest(r))}
+	result.OK = result.joinError == nil
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !result.OK {
+		w.WriteHeader(result.Status)
+	}
+	json.NewEncoder(w).Encode(result)
+}
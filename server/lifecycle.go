@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Goroutine reasons starting with connReasonPrefix belong to a single
+// connection and must all be gone once no clients remain.
+const connReasonPrefix = "conn."
+
+type lifecycleRegistry struct {
+	mu   sync.Mutex
+	live map[string]int
+}
+
+func newLifecycleRegistry() *lifecycleRegistry {
+	return &lifecycleRegistry{live: make(map[string]int)}
+}
+
+func (l *lifecycleRegistry) add(reason string) {
+	l.mu.Lock()
+	l.live[reason]++
+	l.mu.Unlock()
+}
+
+func (l *lifecycleRegistry) done(reason string) {
+	l.mu.Lock()
+	if l.live[reason]--; l.live[reason] <= 0 {
+		delete(l.live, reason)
+	}
+	l.mu.Unlock()
+}
+
+func (l *lifecycleRegistry) snapshot() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	counts := make(map[string]int, len(l.live))
+	for reason, n := range l.live {
+		counts[reason] = n
+	}
+	return counts
+}
+
+// spawn runs fn in a goroutine that is counted under reason while it runs.
+// A panic is logged with its stack instead of taking the process down.
+func (h *Hub) spawn(reason string, fn func()) {
+	h.lifecycle.add(reason)
+	go func() {
+		defer h.lifecycle.done(reason)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("goroutine panic: reason=%s panic=%v\n%s", reason, r, debug.Stack())
+			}
+		}()
+		fn()
+	}()
+}
+
+func (h *Hub) clientCount() int {
+	total := 0
+	h.rooms.each(func(room *Room) {
+		room.mu.RLock()
+		total += len(room.clients)
+		room.mu.RUnlock()
+	})
+	return total
+}
+
+// scheduleLeakCheck runs after a room empties. The delay lets read loops that
+// already queued their unregister finish returning before counts are taken.
+func (h *Hub) scheduleLeakCheck() {
+	time.AfterFunc(time.Second, func() {
+		if h.clientCount() != 0 {
+			return
+		}
+		var leaked []string
+		for reason, n := range h.lifecycle.snapshot() {
+			if strings.HasPrefix(reason, connReasonPrefix) {
+				leaked = append(leaked, reason)
+				log.Printf("leak check: reason=%s live=%d with no clients connected", reason, n)
+			}
+		}
+		if len(leaked) == 0 {
+			log.Printf("leak check: ok")
+		}
+	})
+}
+
+type lifecycleReport struct {
+	Goroutines int            `json:"goroutines"`
+	Live       map[string]int `json:"live"`
+}
+
+func (h *Hub) handleLifecycle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lifecycleReport{Goroutines: runtime.NumGoroutine(), Live: h.lifecycle.snapshot()})
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+
+	"chat/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// openFDs counts the process's open file descriptors, or -1 where /proc is
+// not available.
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+func TestConnectionChurnLeaksNothing(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test")
+	}
+	s := newTestServer(t, func(o *Options) {
+		o.AdmitRate, o.AdmitBurst = 1e6, 1e6
+	})
+	s.join(t, "action=create&room=side&username=anchor")
+	baseGoroutines, baseFDs := runtime.NumGoroutine(), openFDs()
+
+	const cycles = 1000
+	for i := range cycles {
+		c, _ := s.join(t, fmt.Sprintf("room=churn&username=user%d", i))
+		// Vary how connections end: cleanly, by dropping the socket, or
+		// from two rooms at once.
+		switch i % 3 {
+		case 0:
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			c.conn.Close()
+		case 1:
+			c.conn.UnderlyingConn().Close()
+		case 2:
+			c.sendFrame(protocol.Inbound{Type: protocol.TypeJoin, Room: "side"})
+			c.conn.Close()
+		}
+	}
+	waitFor(t, "every churned connection to go", func() bool {
+		return s.getRoom("churn") == nil && s.memberCount("side") == 1 && s.connGoroutines() == 2
+	})
+	// The anchor's read loop and write pump are all that is left.
+	waitFor(t, "goroutines to return to the baseline", func() bool {
+		return runtime.NumGoroutine() <= baseGoroutines+2
+	})
+	if baseFDs >= 0 {
+		waitFor(t, "descriptors to return to the baseline", func() bool { return openFDs() <= baseFDs+2 })
+	}
+}
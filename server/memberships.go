@@ -0,0 +1,152 @@
+package server
+
+import (
+	"slices"
+
+	"chat/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// member returns the membership that frames naming room go to; "" names
+// the first. It is nil if the connection is not in room.
+func (s *session) member(room string) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.rooms {
+		if room == "" || m.room.name == room {
+			return m
+		}
+	}
+	return nil
+}
+
+// roomNames lists the session's rooms in the order it joined them.
+func (s *session) roomNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, len(s.rooms))
+	for i, m := range s.rooms {
+		names[i] = m.room.name
+	}
+	return names
+}
+
+func (s *session) attach(m *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rooms = append(s.rooms, m)
+}
+
+// attached reports whether m is still one of the session's memberships. A
+// membership dropped before Run registered it must not be registered.
+func (s *session) attached(m *Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Contains(s.rooms, m)
+}
+
+// detach gives up m, unless it is the connection's last membership, which
+// only closing the connection ends.
+func (s *session) detach(m *Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.Index(s.rooms, m)
+	if i < 0 {
+		return true
+	}
+	if len(s.rooms) == 1 {
+		return false
+	}
+	s.rooms = slices.Delete(s.rooms, i, i+1)
+	return true
+}
+
+// leaveAll gives up every membership once the read loop has exited, for it
+// to unregister them.
+func (s *session) leaveAll() []*Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	rooms := s.rooms
+	s.rooms = nil
+	return rooms
+}
+
+func (s *session) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// dropMember takes member out of its room. A connection in other rooms as
+// well stays in those; otherwise it is closed with code and reason and its
+// read loop unregisters it as usual. Run must not call it, since it may hand
+// the unregister to Run itself.
+func (h *Hub) dropMember(member *Client, code int, reason string) {
+	if member.detach(member) {
+		h.unregister <- member
+		return
+	}
+	member.kick(code, reason)
+}
+
+// joinRoom adds the connection to the room a join frame names, after the
+// checks a /ws join goes through, under the connection's name. Unlike /ws it
+// never creates the room. It runs on the connection's read loop.
+func (h *Hub) joinRoom(client *Client, name, password string) {
+	first := client.member("")
+	refuse := func(reason string) {
+		h.sendTo(first, newEnvelope(protocol.EventSystem, first.room, "Cannot join "+sanitizeText(name)+": "+reason+".").Encode())
+	}
+	room := h.getRoom(name)
+	switch {
+	case room == nil:
+		refuse("No such room")
+		return
+	case client.member(room.name) != nil, room.present(client.conn):
+		refuse("You are already in it")
+		return
+	}
+	req := joinRequest{room: room.name, password: password, ip: client.ip}
+	if !client.guest {
+		req.username = client.name
+	}
+	if jerr := h.checkJoin(req); jerr != nil {
+		h.usage.countError("join_" + jerr.Code)
+		refuse(jerr.Message)
+		return
+	}
+	if !room.spendRejoinCode(password, client.name) {
+		refuse("Invalid password")
+		return
+	}
+	member := &Client{session: client.session, room: room, limiter: newInboundLimiter(room, room.currentRateProfile(), h.opts.MsgStrikes)}
+	if !room.reserve(member, client.name) {
+		refuse("Room is full")
+		return
+	}
+	client.attach(member)
+	h.register <- member
+}
+
+// present reports whether conn is in r, perhaps through a membership on its
+// way out that a new one must not replace.
+func (r *Room) present(conn *websocket.Conn) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clients[conn] != nil
+}
+
+// leaveRoom takes the connection out of the room a leave frame names; leaving
+// the last one closes the connection.
+func (h *Hub) leaveRoom(client *Client, name string) {
+	member := client.member(name)
+	if member == nil {
+		first := client.member("")
+		h.sendTo(first, newEnvelope(protocol.EventSystem, first.room, "You are not in "+sanitizeText(name)+".").Encode())
+		return
+	}
+	h.sendTo(member, newEnvelope(protocol.EventSystem, member.room, "You left "+member.room.name+".").Encode())
+	h.dropMember(member, websocket.CloseNormalClosure, "left room")
+}
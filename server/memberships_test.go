@@ -0,0 +1,35 @@
+package server
+
+import (
+	"testing"
+
+	"chat/protocol"
+)
+
+func TestJoinedRoomHasItsOwnLimits(t *testing.T) {
+	s := newTestServer(t, func(o *Options) {
+		o.MsgRate = 0.001
+		o.MsgBurst = 3
+	})
+	carol, _ := s.join(t, "room=lobby&username=carol")
+	s.join(t, "action=create&room=busy&username=bob")
+	alice, _ := s.join(t, "room=lobby&username=alice")
+
+	alice.sendFrame(protocol.Inbound{Type: protocol.TypeJoin, Room: "busy"})
+	waitFor(t, "alice to join busy", func() bool { return s.memberCount("busy") == 2 })
+	for range 4 {
+		alice.sendFrame(protocol.Inbound{Type: protocol.EventChat, Room: "busy", Body: "flood"})
+	}
+	if got := alice.nextSystem("too fast"); got.Room != "busy" {
+		t.Fatalf("rate warning for room %q, want busy", got.Room)
+	}
+
+	// The join used one of the lobby's tokens; the flood used none.
+	alice.sendFrame(protocol.Inbound{Type: protocol.EventChat, Room: "lobby", Body: "still here"})
+	for {
+		got := carol.next(protocol.EventChat)
+		if got.Body == "still here" {
+			break
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"strings"
+
+	"chat/protocol"
+)
+
+// Application close codes: members removed by a room's owner or operators,
+// and joins that reach a full room after the upgrade.
+const (
+	closeKicked   = 4001
+	closeRoomFull = 4002
+	closeBanned   = 4003
+)
+
+// command is a slash command typed into the chat box. operator commands are
+// limited to the room owner and the members the owner has promoted; owner
+// commands to the owner alone.
+type command struct {
+	usage    string
+	operator bool
+	owner    bool
+	// bare commands also run without an argument.
+	bare bool
+	run  func(h *Hub, client *Client, arg string) string
+}
+
+var commands = map[string]command{
+	"kick":      {usage: "/kick username", operator: true, run: (*Hub).kickCommand},
+	"ban":       {usage: "/ban username", operator: true, run: (*Hub).banCommand},
+	"op":        {usage: "/op username", owner: true, run: (*Hub).opCommand},
+	"ratelimit": {usage: rateLimitUsage, owner: true, run: (*Hub).rateLimitCommand},
+	"topic":     {usage: "/topic new text", owner: true, run: (*Hub).topicCommand},
+	"private":   {usage: "/private password", owner: true, run: (*Hub).privateCommand},
+	"public":    {usage: "/public", owner: true, bare: true, run: (*Hub).publicCommand},
+	"invite":    {usage: inviteUsage, owner: true, bare: true, run: (*Hub).inviteCommand},
+	"msg":       {usage: msgUsage, run: (*Hub).msgCommand},
+	"nick":      {usage: "/nick newname", run: (*Hub).nickCommand},
+	"remind":    {usage: remindUsage, run: (*Hub).remindCommand},
+	"reminders": {usage: "/reminders [cancel N]", bare: true, run: (*Hub).remindersCommand},
+	"whoami":    {usage: "/whoami", bare: true, run: (*Hub).whoamiCommand},
+}
+
+// runCommand handles body if it starts with a slash and reports whether it
+// did; unknown commands are answered rather than sent as chat. The reply, if
+// any, goes to the sender alone.
+func (h *Hub) runCommand(client *Client, body string) bool {
+	if !strings.HasPrefix(body, "/") {
+		return false
+	}
+	name, arg, _ := strings.Cut(body[1:], " ")
+	room := client.room
+	cmd, ok := commands[name]
+	if !ok {
+		h.sendTo(client, newEnvelope(protocol.EventSystem, room, "Unknown command /"+name+".").Encode())
+		return true
+	}
+	arg = strings.TrimSpace(arg)
+	room.mu.RLock()
+	isOwner := room.ownerID != "" && room.ownerID == client.publicID
+	isOperator := isOwner || room.operators[client.publicID]
+	room.mu.RUnlock()
+
+	var reply string
+	switch {
+	case cmd.owner && !isOwner:
+		reply = "Only the room owner can use /" + name + "."
+	case cmd.operator && !isOperator:
+		reply = "Only the room owner or an operator can use /" + name + "."
+	case arg == "" && !cmd.bare:
+		reply = "Usage: " + cmd.usage
+	default:
+		reply = cmd.run(h, client, arg)
+	}
+	if reply != "" {
+		h.sendTo(client, newEnvelope(protocol.EventSystem, room, reply).Encode())
+	}
+	return true
+}
+
+// moderationTarget finds the member named arg that client may act on, or
+// returns the reason it cannot.
+func (h *Hub) moderationTarget(client *Client, arg string) (*Client, string) {
+	room := client.room
+	target := room.lookupName(arg)
+	if target == nil {
+		return nil, "No one named " + arg + " is in this room."
+	}
+	if target == client {
+		return nil, "You cannot do that to yourself."
+	}
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	if target.publicID == room.ownerID {
+		return nil, "You cannot do that to the room owner."
+	}
+	return target, ""
+}
+
+func (h *Hub) kickCommand(client *Client, arg string) string {
+	target, reason := h.moderationTarget(client, arg)
+	if target == nil {
+		return reason
+	}
+	h.removeMember(target, target.nick()+" was kicked by "+client.nick()+".", closeKicked, "kicked")
+	return ""
+}
+
+// banCommand bans a name from the room, and with -ban-ips the address of the
+// member going by it. Nothing else about a connection outlasts it, so a
+// guest, whose name changes on every join, can only be banned by address,
+// and a named member banned by name alone may come back under another.
+func (h *Hub) banCommand(client *Client, arg string) string {
+	room := client.room
+	target := room.lookupName(arg)
+	if target != nil {
+		var reason string
+		if target, reason = h.moderationTarget(client, arg); target == nil {
+			return reason
+		}
+	}
+	// An address may be shared by a whole network, so it is banned only
+	// with -ban-ips, and never the banner's own.
+	banIP := target != nil && h.opts.BanIPs && target.ip != client.ip
+	if target != nil && target.guest && !banIP {
+		return target.nick() + " is a guest and gets a new name on every join, so a ban would not hold. Use /kick instead, or run the server with -ban-ips."
+	}
+	room.mu.Lock()
+	room.bannedNames[foldName(arg)] = true
+	if banIP {
+		room.bannedIPs[target.ip] = true
+	}
+	room.mu.Unlock()
+	if target == nil {
+		return arg + " is not here but can no longer join."
+	}
+	h.cancelReminders(target)
+	h.removeMember(target, target.nick()+" was banned by "+client.nick()+".", closeBanned, "banned")
+	if !banIP {
+		return "The ban is on the name " + target.nick() + " only; without -ban-ips they can rejoin under another."
+	}
+	return ""
+}
+
+func (h *Hub) opCommand(client *Client, arg string) string {
+	target, reason := h.moderationTarget(client, arg)
+	if target == nil {
+		return reason
+	}
+	room := client.room
+	room.mu.Lock()
+	room.operators[target.publicID] = true
+	room.mu.Unlock()
+	h.broadcastToRoom(room, 0, newEnvelope(protocol.EventSystem, room, target.nick()+" is now an operator.").Encode())
+	return ""
+}
+
+// removeMember announces the removal to the room, target included, and then
+// drops target from it with code.
+func (h *Hub) removeMember(target *Client, notice string, code int, reason string) {
+	h.flushPresence(target.room)
+	h.broadcastToRoom(target.room, 0, newEnvelope(protocol.EventSystem, target.room, notice).Encode())
+	h.dropMember(target, code, reason)
+}
+
+// banned reports whether a join under name from ip is refused.
+func (r *Room) banned(name, ip string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return (name != "" && r.bannedNames[foldName(name)]) || r.bannedIPs[ip]
+}
+
+// nickCommand renames the sender, numbering the new name like a join would
+// if another member has it.
+func (h *Hub) nickCommand(client *Client, arg string) string {
+	if problem := h.opts.usernameProblem(arg); problem != "" {
+		return problem
+	}
+	room := client.room
+	room.mu.Lock()
+	if room.bannedNames[foldName(arg)] {
+		room.mu.Unlock()
+		return "You cannot use that name in this room."
+	}
+	old := client.nick()
+	delete(room.names, foldName(old))
+	name := room.uniqueName(arg)
+	room.names[foldName(name)] = client
+	client.setNick(name)
+	room.mu.Unlock()
+	if name == old {
+		return "You are already known as " + name + "."
+	}
+	h.flushPresence(room)
+	h.broadcastToRoom(room, 0, newEnvelope(protocol.EventSystem, room, old+" is now known as "+name+".").Encode())
+	return ""
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"chat/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNameReadDuringRename(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.join(t, "action=create&room=club&username=alice")
+	s.join(t, "room=club&username=bob")
+	bob := s.getRoom("club").lookupName("bob")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 100 {
+			s.nickCommand(bob, fmt.Sprintf("bob%d", i))
+		}
+	}()
+	for range 100 {
+		if env := chatEnvelope(bob, "hi"); env.Sender == "" {
+			t.Fatal("chat envelope without a sender")
+		}
+	}
+	<-done
+	if got := bob.nick(); got != "bob99" {
+		t.Fatalf("name = %q, want bob99", got)
+	}
+}
+
+// dialFrom joins with query from the loopback address ip, so a test can tell
+// clients apart by address.
+func (s *testServer) dialFrom(t *testing.T, ip, query string) (*testConn, int) {
+	t.Helper()
+	dialer := websocket.Dialer{NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		d := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+		return d.DialContext(ctx, network, addr)
+	}}
+	conn, resp, err := dialer.Dial(s.wsURL(query), nil)
+	if err != nil {
+		if resp == nil {
+			t.Fatalf("dial %s from %s: %v", query, ip, err)
+		}
+		return nil, resp.StatusCode
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testConn{t: t, conn: conn}, http.StatusSwitchingProtocols
+}
+
+func TestBanByName(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner, _ := s.join(t, "action=create&room=club&username=owner")
+	bob, _ := s.dialFrom(t, "127.0.0.2", "room=club&username=bob")
+	bob.next(protocol.EventHello)
+
+	owner.send("/ban bob")
+	if code := bob.closed(); code != closeBanned {
+		t.Fatalf("close code %d, want %d", code, closeBanned)
+	}
+	if _, status := s.dialFrom(t, "127.0.0.2", "room=club&username=bob"); status != http.StatusForbidden {
+		t.Fatalf("banned name rejoined: status %d, want 403", status)
+	}
+	owner.nextSystem("The ban is on the name bob only")
+	// Without -ban-ips others behind bob's address are still welcome.
+	if _, status := s.dialFrom(t, "127.0.0.2", "room=club&username=carol"); status != http.StatusSwitchingProtocols {
+		t.Fatalf("join from bob's address: status %d, want it accepted", status)
+	}
+}
+
+func TestBanGuest(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner, _ := s.join(t, "action=create&room=club&username=owner")
+	guest, _ := s.dialFrom(t, "127.0.0.2", "room=club")
+	name := guest.next(protocol.EventHello).Sender
+	owner.send("/ban " + name)
+	owner.nextSystem(name + " is a guest and gets a new name on every join")
+	if n := s.memberCount("club"); n != 2 {
+		t.Fatalf("%d members after a refused ban, want 2", n)
+	}
+
+	s = newTestServer(t, func(o *Options) { o.BanIPs = true })
+	owner, _ = s.join(t, "action=create&room=club&username=owner")
+	conn, _ := s.dialFrom(t, "127.0.0.2", "room=club")
+	hello := conn.next(protocol.EventHello)
+	owner.send("/ban " + hello.Sender)
+	if code := conn.closed(); code != closeBanned {
+		t.Fatalf("close code %d, want %d", code, closeBanned)
+	}
+	if _, status := s.dialFrom(t, "127.0.0.2", "room=club"); status != http.StatusForbidden {
+		t.Fatalf("banned guest rejoined: status %d, want 403", status)
+	}
+}
+
+func TestBanIPs(t *testing.T) {
+	s := newTestServer(t, func(o *Options) { o.BanIPs = true })
+	owner, _ := s.join(t, "action=create&room=club&username=owner")
+	bob, _ := s.dialFrom(t, "127.0.0.2", "room=club&username=bob")
+	bob.next(protocol.EventHello)
+	s.join(t, "room=club&username=dave")
+
+	owner.send("/ban bob")
+	bob.closed()
+	if _, status := s.dialFrom(t, "127.0.0.2", "room=club&username=carol"); status != http.StatusForbidden {
+		t.Fatalf("join from a banned address: status %d, want 403", status)
+	}
+
+	// A member sharing the banner's address is banned by name only.
+	owner.send("/ban dave")
+	waitFor(t, "dave to be banned", func() bool { return s.memberCount("club") == 1 })
+	s.join(t, "room=club&username=erin")
+}
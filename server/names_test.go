@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func testRoom(tb testing.TB) (*Hub, *Room) {
+	tb.Helper()
+	h, err := NewHub(DefaultOptions())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	room, _ := h.createRoom("names", "", false, 0, false, "")
+	return h, room
+}
+
+func TestReserveSameNameInParallel(t *testing.T) {
+	_, room := testRoom(t)
+	const joins = 50
+	clients := make([]*Client, joins)
+	var wg sync.WaitGroup
+	for i := range clients {
+		clients[i] = &Client{room: room}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			room.reserve(clients[i], "Alice")
+		}()
+	}
+	wg.Wait()
+	seen := make(map[string]bool)
+	for _, c := range clients {
+		key := foldName(c.nick())
+		if seen[key] {
+			t.Fatalf("name %q handed out twice", c.nick())
+		}
+		seen[key] = true
+		if room.lookupName(c.nick()) != c {
+			t.Fatalf("lookup of %q did not find its holder", c.nick())
+		}
+	}
+	if room.lookupName("alice") == nil {
+		t.Fatal("folded lookup of alice failed")
+	}
+}
+
+func TestReserveReleaseAndLookupInParallel(t *testing.T) {
+	_, room := testRoom(t)
+	const members = 20
+	var wg sync.WaitGroup
+	for i := range members {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for n := range 20 {
+				c := &Client{room: room}
+				room.reserve(c, fmt.Sprintf("member%d-%d", i, n))
+				if n < 19 {
+					room.mu.Lock()
+					room.release(c)
+					room.mu.Unlock()
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for n := range 20 {
+				room.lookupName(fmt.Sprintf("member%d-%d", (i+1)%members, n))
+			}
+		}()
+	}
+	wg.Wait()
+	for i := range members {
+		if c := room.lookupName(fmt.Sprintf("Member%d-19", i)); c == nil || c.nick() != fmt.Sprintf("member%d-19", i) {
+			t.Fatalf("member %d's last name is not indexed", i)
+		}
+		if room.lookupName(fmt.Sprintf("member%d-18", i)) != nil {
+			t.Fatalf("member %d's released name is still indexed", i)
+		}
+	}
+}
+
+func TestRenameJoinAndLookupInParallel(t *testing.T) {
+	h, room := testRoom(t)
+	const members = 20
+	clients := make([]*Client, members)
+	for i := range clients {
+		clients[i] = &Client{room: room}
+		room.reserve(clients[i], fmt.Sprintf("member%d", i))
+	}
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for n := range 20 {
+				h.nickCommand(c, fmt.Sprintf("renamed%d-%d", i, n))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			room.reserve(&Client{room: room}, "member0")
+		}()
+		go func() {
+			defer wg.Done()
+			for n := range 20 {
+				room.lookupName(fmt.Sprintf("renamed%d-%d", (i+1)%members, n))
+			}
+		}()
+	}
+	wg.Wait()
+	for i, c := range clients {
+		want := fmt.Sprintf("renamed%d-19", i)
+		if c.nick() != want || room.lookupName(want) != c {
+			t.Fatalf("member %d is %q, want %q and found by it", i, c.nick(), want)
+		}
+		if room.lookupName(fmt.Sprintf("renamed%d-18", i)) != nil {
+			t.Fatalf("member %d's old name is still indexed", i)
+		}
+	}
+}
+
+func BenchmarkNameIndex(b *testing.B) {
+	_, room := testRoom(b)
+	const members = 10000
+	for i := range members {
+		room.reserve(&Client{room: room}, fmt.Sprintf("member%d", i))
+	}
+	b.Run("lookup", func(b *testing.B) {
+		i := 0
+		for b.Loop() {
+			room.lookupName(fmt.Sprintf("Member%d", i%members))
+			i++
+		}
+	})
+	b.Run("reserve-taken", func(b *testing.B) {
+		for b.Loop() {
+			c := &Client{room: room}
+			room.reserve(c, "member5")
+			room.mu.Lock()
+			room.release(c)
+			room.mu.Unlock()
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Options configures a Hub. Start from DefaultOptions; each field matches the
+// command-line flag RegisterFlags binds it to, whose help text documents it.
+type Options struct {
+	RoomsToken     string
+	RoomsOpen      bool
+	AllowedOrigins string
+	PublicURL      string
+
+	AdmitRate  float64
+	AdmitBurst int
+	AdmitWait  time.Duration
+	AdmitQueue int
+
+	MaxConnections      int
+	ReservedProvisioned int
+	ReservedAdmin       int
+
+	PingInterval   time.Duration
+	PongWait       time.Duration
+	WriteWait      time.Duration
+	SendBuffer     int
+	ReplayBuffer   int
+	MaxMessageSize int
+
+	MsgRate      float64
+	MsgBurst     int
+	MaxMsgRate   float64
+	MaxMsgBurst  int
+	RateProfile  string
+	RoomMsgRate  float64
+	RoomMsgBurst int
+	MsgStrikes   int
+
+	JoinAttempts      int
+	APIKeyRequests    int
+	MaxReservation    time.Duration
+	ReservationsPerIP int
+	MaxReminders      int
+	BanIPs            bool
+
+	MaxUsernameLength int
+	LenientUsernames  bool
+
+	StormLeaves   int
+	StormWindow   time.Duration
+	StormCooldown time.Duration
+	PresenceFlush time.Duration
+
+	RoomIdleTTL   time.Duration
+	RoomIdleCheck time.Duration
+
+	RoomsConfig             string
+	RoomsConfigCloseRemoved bool
+	Persist                 string
+
+	DailyReport        string
+	DailyReportTZ      string
+	DailyReportWebhook string
+
+	StaticDir string
+	NoStatic  bool
+	// Frontend is a built frontend to serve beneath StaticDir, such as one
+	// embedded in the binary; nil falls back to ./build.
+	Frontend fs.FS
+
+	Debug     bool
+	LeakCheck bool
+}
+
+// DefaultOptions returns the settings the server runs with when no flag is
+// given.
+func DefaultOptions() Options {
+	return Options{
+		RoomsOpen:         true,
+		AllowedOrigins:    "*",
+		AdmitRate:         50,
+		AdmitBurst:        100,
+		AdmitWait:         2 * time.Second,
+		AdmitQueue:        200,
+		PingInterval:      30 * time.Second,
+		PongWait:          40 * time.Second,
+		WriteWait:         10 * time.Second,
+		SendBuffer:        256,
+		ReplayBuffer:      100,
+		MaxMessageSize:    4096,
+		MsgRate:           5,
+		MsgBurst:          10,
+		MaxMsgRate:        20,
+		MaxMsgBurst:       50,
+		RateProfile:       "standard",
+		RoomMsgRate:       50,
+		RoomMsgBurst:      100,
+		MsgStrikes:        5,
+		JoinAttempts:      10,
+		APIKeyRequests:    60,
+		MaxReservation:    7 * 24 * time.Hour,
+		ReservationsPerIP: 3,
+		MaxReminders:      5,
+		MaxUsernameLength: 32,
+		StormLeaves:       5,
+		StormWindow:       10 * time.Second,
+		StormCooldown:     30 * time.Second,
+		PresenceFlush:     100 * time.Millisecond,
+		RoomIdleCheck:     time.Minute,
+	}
+}
+
+// RegisterFlags binds every option to a flag on fs, using the current values
+// as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.RoomsToken, "rooms-token", o.RoomsToken, "token required by /rooms, /rooms/reserve and /rooms/invite; see -rooms-open when empty, though /rooms/invite is then refused")
+	fs.BoolVar(&o.RoomsOpen, "rooms-open", o.RoomsOpen, "with no -rooms-token, serve /rooms and /rooms/reserve to anyone; false disables them")
+	fs.StringVar(&o.AllowedOrigins, "allowed-origins", o.AllowedOrigins, "comma-separated origins (scheme://host[:port]) allowed to open /ws, or * for any")
+	fs.StringVar(&o.PublicURL, "public-url", o.PublicURL, "scheme://host[:port] clients reach the server at, for the absolute links in room previews; when empty they use the request's Host and shared caches may not keep previews")
+
+	fs.Float64Var(&o.AdmitRate, "admit-rate", o.AdmitRate, "new /ws connections admitted per second across the server")
+	fs.IntVar(&o.AdmitBurst, "admit-burst", o.AdmitBurst, "new /ws connections admitted at once before -admit-rate applies")
+	fs.DurationVar(&o.AdmitWait, "admit-wait", o.AdmitWait, "longest a new connection may queue for admission before it is turned away")
+	fs.IntVar(&o.AdmitQueue, "admit-queue", o.AdmitQueue, "new connections that may queue for admission at once")
+
+	fs.IntVar(&o.MaxConnections, "max-connections", o.MaxConnections, "connections allowed across the server; 0 for no limit; changing it needs a restart, since a SIGHUP reload keeps the cap and both reserves")
+	fs.IntVar(&o.ReservedProvisioned, "reserved-provisioned", o.ReservedProvisioned, "connections out of -max-connections held back for provisioned rooms; changing it needs a restart")
+	fs.IntVar(&o.ReservedAdmin, "reserved-admin", o.ReservedAdmin, "connections out of -max-connections held back for admin rooms; changing it needs a restart")
+
+	fs.DurationVar(&o.PingInterval, "ping-interval", o.PingInterval, "how often to ping each client")
+	fs.DurationVar(&o.PongWait, "pong-wait", o.PongWait, "how long to wait for any frame, including a pong, before dropping a client; must exceed -ping-interval")
+	fs.DurationVar(&o.WriteWait, "write-wait", o.WriteWait, "how long one write to a client may take before it is dropped as a slow consumer")
+	fs.IntVar(&o.SendBuffer, "send-buffer", o.SendBuffer, "outbound frames that may queue for one client before it is dropped as a slow consumer")
+	fs.IntVar(&o.ReplayBuffer, "replay-buffer", o.ReplayBuffer, "chat messages each room keeps in memory for members rejoining with ?since=; 0 disables replay; at most -send-buffer minus 2")
+	fs.IntVar(&o.MaxMessageSize, "max-message-size", o.MaxMessageSize, "largest frame in bytes a client may send; larger frames are refused, and frames over four times this end the connection")
+
+	fs.Float64Var(&o.MsgRate, "msg-rate", o.MsgRate, "frames per second each connection may send under the standard rate profile")
+	fs.IntVar(&o.MsgBurst, "msg-burst", o.MsgBurst, "frames a connection may send at once under the standard rate profile")
+	fs.Float64Var(&o.MaxMsgRate, "max-msg-rate", o.MaxMsgRate, "highest per-connection rate a room owner may choose")
+	fs.IntVar(&o.MaxMsgBurst, "max-msg-burst", o.MaxMsgBurst, "highest per-connection burst a room owner may choose")
+	fs.StringVar(&o.RateProfile, "rate-profile", o.RateProfile, "rate profile new rooms start with: relaxed, standard or strict")
+	fs.Float64Var(&o.RoomMsgRate, "room-msg-rate", o.RoomMsgRate, "frames per second all members of one room may send together")
+	fs.IntVar(&o.RoomMsgBurst, "room-msg-burst", o.RoomMsgBurst, "frames a room may send at once before -room-msg-rate applies")
+	fs.IntVar(&o.MsgStrikes, "msg-strikes", o.MsgStrikes, "rate limit warnings a connection may collect within a minute before it is disconnected")
+
+	fs.IntVar(&o.JoinAttempts, "join-attempts", o.JoinAttempts, "failed password attempts allowed per IP per minute across /ws and /ws/preflight")
+	fs.IntVar(&o.APIKeyRequests, "api-key-requests", o.APIKeyRequests, "requests each room API key may make per minute")
+	fs.DurationVar(&o.MaxReservation, "max-reservation", o.MaxReservation, "longest time a room name can be reserved ahead")
+	fs.IntVar(&o.ReservationsPerIP, "reservations-per-ip", o.ReservationsPerIP, "active room name reservations allowed per IP")
+	fs.IntVar(&o.MaxReminders, "max-reminders", o.MaxReminders, "pending /remind reminders allowed per connection")
+	fs.BoolVar(&o.BanIPs, "ban-ips", o.BanIPs, "make /ban also refuse the banned member's IP address, shutting out everyone else behind it")
+
+	fs.IntVar(&o.MaxUsernameLength, "max-username-length", o.MaxUsernameLength, "longest name in characters a user may choose")
+	fs.BoolVar(&o.LenientUsernames, "lenient-usernames", o.LenientUsernames, "give users who choose an invalid name a guest name instead of refusing the join")
+
+	fs.IntVar(&o.StormLeaves, "storm-leaves", o.StormLeaves, "leaves within -storm-window that put a room's presence messages into summary mode; 0 disables")
+	fs.DurationVar(&o.StormWindow, "storm-window", o.StormWindow, "window in which -storm-leaves leaves count as a mass disconnect")
+	fs.DurationVar(&o.StormCooldown, "storm-cooldown", o.StormCooldown, "how long a room stays in summary mode before the held presence changes are announced")
+	fs.DurationVar(&o.PresenceFlush, "presence-flush", o.PresenceFlush, "how long join and leave events are held so a burst of them goes out as one presence event; 0 sends each at once")
+
+	fs.DurationVar(&o.RoomIdleTTL, "room-idle-ttl", o.RoomIdleTTL, "close rooms with no joins or messages for this long; 0 disables")
+	fs.DurationVar(&o.RoomIdleCheck, "room-idle-check", o.RoomIdleCheck, "how often rooms are checked against -room-idle-ttl")
+
+	fs.StringVar(&o.RoomsConfig, "rooms-config", o.RoomsConfig, "JSON file of rooms to create on startup and reconcile on SIGHUP")
+	fs.BoolVar(&o.RoomsConfigCloseRemoved, "rooms-config-close-removed", o.RoomsConfigCloseRemoved, "close provisioned rooms that disappear from -rooms-config on reload")
+	fs.StringVar(&o.Persist, "persist", o.Persist, "JSON file room settings and replay history are saved to as they change and restored from on startup; empty keeps rooms in memory only")
+
+	fs.StringVar(&o.DailyReport, "daily-report", o.DailyReport, "directory a JSON usage report is written to at each midnight; empty disables usage counting")
+	fs.StringVar(&o.DailyReportTZ, "daily-report-tz", o.DailyReportTZ, "IANA time zone whose midnight ends a -daily-report day; empty for the server's local zone")
+	fs.StringVar(&o.DailyReportWebhook, "daily-report-webhook", o.DailyReportWebhook, "URL each -daily-report is also POSTed to as JSON")
+
+	fs.StringVar(&o.StaticDir, "static", o.StaticDir, "serve the frontend from this directory, falling back to the embedded build")
+	fs.BoolVar(&o.NoStatic, "no-static", o.NoStatic, "do not serve the frontend at all")
+
+	fs.BoolVar(&o.Debug, "debug", o.Debug, "serve the /debug/ endpoints (goroutine lifecycle, janitor queue, client error counts, connection admission, and the day's usage report with -daily-report)")
+	fs.BoolVar(&o.LeakCheck, "leak-check", o.LeakCheck, "log per-connection goroutines still alive once every client has disconnected")
+}
+
+// validate rejects combinations the server cannot run with.
+func (o *Options) validate() error {
+	if o.PongWait <= o.PingInterval {
+		return fmt.Errorf("-pong-wait (%v) must be longer than -ping-interval (%v)", o.PongWait, o.PingInterval)
+	}
+	if _, ok := o.namedProfile(o.RateProfile); !ok {
+		return fmt.Errorf("-rate-profile %q is not relaxed, standard or strict", o.RateProfile)
+	}
+	if o.MaxUsernameLength < 1 {
+		return fmt.Errorf("-max-username-length (%d) must be at least 1", o.MaxUsernameLength)
+	}
+	if o.SendBuffer < 1 {
+		return fmt.Errorf("-send-buffer (%d) must be at least 1", o.SendBuffer)
+	}
+	if o.PublicURL != "" {
+		u, err := url.Parse(o.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return fmt.Errorf("-public-url %q is not of the form scheme://host[:port]", o.PublicURL)
+		}
+	}
+	if _, err := o.reportLocation(); err != nil {
+		return err
+	}
+	// A rejoining member is queued its hello, the topic and the whole
+	// replay buffer at once.
+	if o.ReplayBuffer+joinFrames > o.SendBuffer {
+		return fmt.Errorf("-replay-buffer (%d) must be at least %d smaller than -send-buffer (%d)", o.ReplayBuffer, joinFrames, o.SendBuffer)
+	}
+	if o.MaxConnections > 0 && o.ReservedProvisioned+o.ReservedAdmin > o.MaxConnections {
+		return fmt.Errorf("-reserved-provisioned plus -reserved-admin (%d) exceeds -max-connections (%d)", o.ReservedProvisioned+o.ReservedAdmin, o.MaxConnections)
+	}
+	return nil
+}
+
+// reportLocation is the time zone -daily-report days are counted in.
+func (o *Options) reportLocation() (*time.Location, error) {
+	if o.DailyReportTZ == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(o.DailyReportTZ)
+	if err != nil {
+		return nil, fmt.Errorf("-daily-report-tz: %v", err)
+	}
+	return loc, nil
+}
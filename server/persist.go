@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"chat/protocol"
+)
+
+// persistInterval is the least time between two saves of the room list.
+const persistInterval = time.Second
+
+// persistedRoom is what survives a restart. Members, operators and bans are
+// tied to connections and do not; the owner comes back by joining with the
+// owner code, whose sha256 is OwnerCode. History is the replay buffer,
+// oldest first, so members rejoining with ?since= after a restart still get
+// what they missed. Reminders wait for their members to rejoin by name.
+type persistedRoom struct {
+	Name            string              `json:"name"`
+	PasswordHash    string              `json:"passwordHash,omitempty"`
+	Private         bool                `json:"private,omitempty"`
+	Capacity        int                 `json:"capacity,omitempty"`
+	RequireUsername bool                `json:"requireUsername,omitempty"`
+	Topic           string              `json:"topic,omitempty"`
+	OwnerCode       string              `json:"ownerCode,omitempty"`
+	Seq             uint64              `json:"seq,omitempty"`
+	History         []protocol.Envelope `json:"history,omitempty"`
+	Reminders       []persistedReminder `json:"reminders,omitempty"`
+}
+
+type persistedReminder struct {
+	Name string    `json:"name"`
+	Due  time.Time `json:"due"`
+	Text string    `json:"text"`
+}
+
+// roomStore writes the room list to disk off the hot path: changes only mark
+// it dirty, and one goroutine rewrites the whole file, so a burst of changes
+// costs a single write. mu keeps a save from landing on top of a newer one.
+type roomStore struct {
+	path  string
+	dirty chan struct{}
+	mu    sync.Mutex
+}
+
+func (h *Hub) roomsChanged() {
+	if h.store == nil {
+		return
+	}
+	select {
+	case h.store.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// restoreRooms recreates the rooms saved at path and starts saving there.
+// A missing file is a first run, not an error.
+func (h *Hub) restoreRooms(path string) error {
+	h.store = &roomStore{path: path, dirty: make(chan struct{}, 1)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved []persistedRoom
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	restored := 0
+	for _, pr := range saved {
+		room := h.newRoom(pr.Name, pr.PasswordHash, pr.Private)
+		room.capacity = pr.Capacity
+		room.requireUsername = pr.RequireUsername
+		room.topic = pr.Topic
+		if code, err := hex.DecodeString(pr.OwnerCode); err == nil && len(code) == sha256.Size {
+			copy(room.ownerCode[:], code)
+		}
+		room.seq = pr.Seq
+		for _, env := range pr.History {
+			room.replay.add(h.opts.ReplayBuffer, replayEntry{env.Seq, env, env.Encode()})
+		}
+		if !h.rooms.insert(room) {
+			continue
+		}
+		for _, r := range pr.Reminders {
+			h.restoreReminder(room, r.Name, r.Due, r.Text)
+		}
+		restored++
+	}
+	log.Printf("Restored %d rooms from %s", restored, path)
+	return nil
+}
+
+// persistRooms saves the room list each time it changes, a chat message
+// included, but at most once per persistInterval. Provisioned rooms belong
+// to -rooms-config and are left out. Nothing is saved while draining; Drain
+// saves once more at the end instead.
+func (h *Hub) persistRooms(ctx context.Context) {
+	for {
+		select {
+		case <-h.store.dirty:
+		case <-ctx.Done():
+			return
+		}
+		if h.draining.Load() {
+			continue
+		}
+		h.saveRooms()
+		select {
+		case <-h.janitor.clock.After(persistInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *Hub) saveRooms() {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+	saved := make([]persistedRoom, 0)
+	h.rooms.each(func(room *Room) {
+		room.mu.RLock()
+		defer room.mu.RUnlock()
+		if room.provisioned {
+			return
+		}
+		pr := persistedRoom{
+			Name:            room.name,
+			PasswordHash:    room.password,
+			Private:         room.private,
+			Capacity:        room.capacity,
+			RequireUsername: room.requireUsername,
+			Topic:           room.topic,
+			Seq:             room.seq,
+			History:         room.replay.envelopes(),
+		}
+		if room.ownerCode != ([sha256.Size]byte{}) {
+			pr.OwnerCode = hex.EncodeToString(room.ownerCode[:])
+		}
+		for _, held := range room.reminders {
+			pr.Reminders = append(pr.Reminders, persistedReminder{held.name, held.due, held.text})
+		}
+		for _, client := range room.clients {
+			if client.guest {
+				continue
+			}
+			client.reminders.mu.Lock()
+			for _, r := range client.reminders.pending {
+				pr.Reminders = append(pr.Reminders, persistedReminder{foldName(client.nick()), r.due, r.text})
+			}
+			client.reminders.mu.Unlock()
+		}
+		saved = append(saved, pr)
+	})
+	if err := writeFileAtomic(h.store.path, saved); err != nil {
+		log.Printf("Failed to save rooms to %s: %v", h.store.path, err)
+	}
+}
+
+// writeFileAtomic replaces path with v as JSON, so a crash mid-write leaves
+// the previous file intact. The file holds password hashes and is private
+// to the server's user.
+func writeFileAtomic(path string, v any) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
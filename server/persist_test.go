@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"chat/protocol"
+)
+
+func TestPersistedHistoryReplaysAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+	withPersist := func(o *Options) { o.Persist = path }
+
+	before := newTestServer(t, withPersist)
+	alice, _ := before.join(t, "room=lobby&username=alice")
+	bob, _ := before.join(t, "room=lobby&username=bob")
+	for i := 1; i <= 3; i++ {
+		alice.send(fmt.Sprintf("message %d", i))
+		bob.next(protocol.EventChat)
+	}
+	waitFor(t, "the history to be saved", func() bool {
+		before.clock.Advance(persistInterval)
+		saved := readSaved(path)
+		return len(saved) == 1 && saved[0].Seq == 3 && len(saved[0].History) == 3
+	})
+
+	after := newTestServer(t, withPersist)
+	carol, _ := after.join(t, "room=lobby&username=carol&since=1")
+	for want := uint64(2); want <= 3; want++ {
+		if got := carol.next(protocol.EventChat); got.Seq != want || got.Body != fmt.Sprintf("message %d", want) || got.Sender != "alice" {
+			t.Fatalf("replayed %+v, want message %d", got, want)
+		}
+	}
+	dave, _ := after.join(t, "room=lobby&username=dave")
+	dave.send("after the restart")
+	if got := carol.next(protocol.EventChat); got.Seq != 4 {
+		t.Fatalf("first message after the restart has seq %d, want 4", got.Seq)
+	}
+}
+
+// readSaved returns the rooms saved at path, or none if it cannot be read.
+func readSaved(path string) []persistedRoom {
+	data, _ := os.ReadFile(path)
+	var saved []persistedRoom
+	json.Unmarshal(data, &saved)
+	return saved
+}
+
+func TestSavesAtMostOncePerInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+	s := newTestServer(t, func(o *Options) { o.Persist = path })
+	alice, _ := s.join(t, "room=lobby&username=alice")
+	bob, _ := s.join(t, "room=lobby&username=bob")
+	waitFor(t, "the room to be saved", func() bool { return len(readSaved(path)) == 1 })
+	for i := 1; i <= 5; i++ {
+		alice.send(fmt.Sprintf("message %d", i))
+		bob.next(protocol.EventChat)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if saved := readSaved(path); saved[0].Seq != 0 {
+		t.Fatalf("saved seq %d before persistInterval passed, want the first save only", saved[0].Seq)
+	}
+	s.clock.Advance(persistInterval)
+	waitFor(t, "the messages to be saved in one write", func() bool {
+		saved := readSaved(path)
+		return saved[0].Seq == 5
+	})
+}
+
+func TestDrainSavesRoomsItEmpties(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+	s := newTestServer(t, func(o *Options) { o.Persist = path })
+	alice, _ := s.join(t, "room=lobby&username=alice")
+	bob, _ := s.join(t, "room=lobby&username=bob")
+	waitFor(t, "the room to be saved", func() bool { return len(readSaved(path)) == 1 })
+	alice.send("before shutdown")
+	bob.next(protocol.EventChat)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.Drain(ctx)
+	saved := readSaved(path)
+	if len(saved) != 1 || saved[0].Name != "lobby" || saved[0].Seq != 1 {
+		t.Fatalf("saved %+v after drain, want lobby at seq 1", saved)
+	}
+}
+
+func TestOwnerCodeReclaimsRoomAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+	withPersist := func(o *Options) { o.Persist = path }
+
+	before := newTestServer(t, withPersist)
+	_, hello := before.join(t, "room=den&action=create&username=alice")
+	if hello.OwnerCode == "" {
+		t.Fatal("creator's hello carries no owner code")
+	}
+	waitFor(t, "the owner code to be saved", func() bool {
+		before.clock.Advance(persistInterval)
+		saved := readSaved(path)
+		return len(saved) == 1 && saved[0].OwnerCode != ""
+	})
+	if saved := readSaved(path); saved[0].OwnerCode == hello.OwnerCode {
+		t.Fatal("owner code saved in the clear")
+	}
+
+	after := newTestServer(t, withPersist)
+	if status := after.dialStatus(t, "room=den&username=mallory&owner=wrong"); status != http.StatusUnauthorized {
+		t.Fatalf("wrong owner code: status %d, want 401", status)
+	}
+	_, mallory := after.join(t, "room=den&username=mallory")
+	_, reclaimed := after.join(t, "room=den&owner="+hello.OwnerCode)
+	room := after.getRoom("den")
+	room.mu.RLock()
+	owner := room.ownerID
+	room.mu.RUnlock()
+	if owner != reclaimed.SenderID || owner == mallory.SenderID {
+		t.Fatalf("owner is %q, want the guest who joined with the code (%q)", owner, reclaimed.SenderID)
+	}
+	if reclaimed.OwnerCode != "" {
+		t.Fatal("reclaiming minted a new owner code")
+	}
+}
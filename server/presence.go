@@ -0,0 +1,160 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"chat/protocol"
+)
+
+// presenceStorm tracks recent leaves in a room. Once more than -storm-leaves
+// members leave within -storm-window, join and leave events are still sent
+// but marked quiet, so clients update their member lists without printing a
+// line each, and one summary is announced when -storm-cooldown ends. It is
+// guarded by the room's mu.
+type presenceStorm struct {
+	recent []presenceLeave
+	active bool
+	// left maps the folded names of everyone who left during the storm,
+	// including the leaves that started it, to whether a "left" line was
+	// already shown for them.
+	left        map[string]bool
+	reconnected int
+	joined      int
+}
+
+type presenceLeave struct {
+	at   time.Time
+	name string
+}
+
+// noteLeave records a leave and reports whether its event should be quiet
+// and whether it started a storm of more than leaves leaves within window,
+// in which case the caller schedules end.
+func (s *presenceStorm) noteLeave(now time.Time, name string, leaves int, window time.Duration) (quiet, started bool) {
+	key := foldName(name)
+	if s.active {
+		if _, seen := s.left[key]; !seen {
+			s.left[key] = false
+		}
+		return true, false
+	}
+	if leaves <= 0 {
+		return false, false
+	}
+	cutoff := now.Add(-window)
+	kept := s.recent[:0]
+	for _, leave := range s.recent {
+		if leave.at.After(cutoff) {
+			kept = append(kept, leave)
+		}
+	}
+	s.recent = append(kept, presenceLeave{at: now, name: key})
+	if len(s.recent) <= leaves {
+		return false, false
+	}
+	s.active = true
+	s.left = make(map[string]bool, len(s.recent))
+	for _, leave := range s.recent[:len(s.recent)-1] {
+		s.left[leave.name] = true
+	}
+	s.left[key] = false
+	s.recent = nil
+	return true, true
+}
+
+// noteJoin records a join and reports whether its event should be quiet.
+// A join under the name of someone who left during the storm counts as a
+// reconnect.
+func (s *presenceStorm) noteJoin(name string) bool {
+	if !s.active {
+		return false
+	}
+	key := foldName(name)
+	if _, ok := s.left[key]; ok {
+		delete(s.left, key)
+		s.reconnected++
+	} else {
+		s.joined++
+	}
+	return true
+}
+
+// end leaves summary mode and returns the announcement, or "" if nothing
+// held back needs one.
+func (s *presenceStorm) end() string {
+	var parts []string
+	if s.reconnected > 0 {
+		parts = append(parts, plural(s.reconnected, "user")+" reconnected")
+	}
+	left := 0
+	for _, shown := range s.left {
+		if !shown {
+			left++
+		}
+	}
+	if left > 0 {
+		parts = append(parts, plural(left, "user")+" left")
+	}
+	if s.joined > 0 {
+		parts = append(parts, plural(s.joined, "user")+" joined")
+	}
+	*s = presenceStorm{}
+	return strings.Join(parts, ", ")
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// scheduleStormEnd announces the room's held presence changes once the
+// cooldown passes.
+func (h *Hub) scheduleStormEnd(room *Room) {
+	h.janitor.schedule("presence-storm", h.opts.StormCooldown, func() {
+		room.mu.Lock()
+		summary := room.storm.end()
+		room.mu.Unlock()
+		if summary != "" {
+			h.flushPresence(room)
+			h.broadcastToRoom(room, 0, newEnvelope(protocol.EventSystem, room, summary+".").Encode())
+		}
+	})
+}
+
+// queuePresence holds a join or leave event for the room's next presence
+// flush, scheduling one if none is pending.
+func (h *Hub) queuePresence(room *Room, env protocol.Envelope) {
+	if h.opts.PresenceFlush <= 0 {
+		h.broadcastToRoom(room, 0, env.Encode())
+		return
+	}
+	room.mu.Lock()
+	room.pendingPresence = append(room.pendingPresence, env)
+	first := len(room.pendingPresence) == 1
+	room.mu.Unlock()
+	if first {
+		h.janitor.schedule("presence-flush", h.opts.PresenceFlush, func() { h.flushPresence(room) })
+	}
+}
+
+// flushPresence sends the room's held presence events: a lone event as it
+// is, several as one presence event listing each change in order. Callers
+// about to broadcast anything else to the room flush first so members never
+// see a message from someone before the join that let them in.
+func (h *Hub) flushPresence(room *Room) {
+	room.mu.Lock()
+	pending := room.pendingPresence
+	room.pendingPresence = nil
+	room.mu.Unlock()
+	switch len(pending) {
+	case 0:
+	case 1:
+		h.broadcastToRoom(room, 0, pending[0].Encode())
+	default:
+		h.broadcastToRoom(room, 0, presenceBatchEnvelope(room, pending).Encode())
+	}
+}
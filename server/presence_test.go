@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"chat/protocol"
+)
+
+func withStorm(o *Options) {
+	o.StormLeaves, o.StormWindow, o.StormCooldown = 2, 10*time.Second, 30*time.Second
+}
+
+// TestStormThresholdAndWindow leaves -storm-leaves members inside the window,
+// then one more once it has passed, then enough for a storm: only the leave
+// over the threshold within one window is quiet.
+func TestStormThresholdAndWindow(t *testing.T) {
+	s := newTestServer(t, withStorm)
+	watcher, _ := s.join(t, "room=lobby&username=watcher")
+	members := make([]*testConn, 5)
+	for i := range members {
+		members[i], _ = s.join(t, fmt.Sprintf("room=lobby&username=m%d", i+1))
+	}
+	leave := func(i int, wantQuiet bool) {
+		t.Helper()
+		s.leave(t, members[i], "lobby", len(members)-i)
+		env := watcher.next(protocol.EventLeave)
+		if want := fmt.Sprintf("m%d left", i+1); env.Body != want || env.Quiet != wantQuiet {
+			t.Fatalf("leave %q quiet=%v, want %q quiet=%v", env.Body, env.Quiet, want, wantQuiet)
+		}
+	}
+	leave(0, false)
+	leave(1, false)
+	s.clock.Advance(11 * time.Second)
+	leave(2, false)
+	leave(3, false)
+	leave(4, true)
+
+	s.clock.Advance(30 * time.Second)
+	if got := watcher.next(protocol.EventSystem); got.Body != "1 user left." {
+		t.Fatalf("storm summary %q, want %q", got.Body, "1 user left.")
+	}
+}
+
+// presenceFramesDuringChurn has ten members join and leave while a watcher
+// looks on, and counts the presence frames the watcher gets before the next
+// chat message.
+func presenceFramesDuringChurn(t *testing.T, flush time.Duration) int {
+	s := newTestServer(t, func(o *Options) { o.PresenceFlush = flush })
+	watcher, _ := s.join(t, "room=lobby&username=watcher")
+	marker, _ := s.join(t, "room=lobby&username=marker")
+	for i := range 10 {
+		c, _ := s.join(t, fmt.Sprintf("room=lobby&username=churn%d", i))
+		s.leave(t, c, "lobby", 2)
+	}
+	marker.send("done")
+	frames := 0
+	for {
+		env, err := watcher.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch env.Type {
+		case protocol.EventJoin, protocol.EventLeave, protocol.EventPresence:
+			frames++
+		case protocol.EventChat:
+			return frames
+		}
+	}
+}
+
+func TestPresenceCoalescingCutsFrames(t *testing.T) {
+	separate := presenceFramesDuringChurn(t, 0)
+	coalesced := presenceFramesDuringChurn(t, time.Second)
+	// The watcher's and marker's joins and the churn's 20 joins and leaves.
+	if separate != 22 {
+		t.Fatalf("%d presence frames without coalescing, want one per join and leave (22)", separate)
+	}
+	if coalesced*2 > separate {
+		t.Fatalf("%d presence frames with coalescing, want at most half of %d", coalesced, separate)
+	}
+}
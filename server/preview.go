@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	previewSiteName    = "TempChat"
+	previewDescription = "Quick & temporary chat rooms"
+)
+
+type roomPreviewHandler struct {
+	hub  *Hub
+	fsys fs.FS
+}
+
+func newRoomPreviewHandler(h *Hub, fsys fs.FS) *roomPreviewHandler {
+	return &roomPreviewHandler{hub: h, fsys: fsys}
+}
+
+var (
+	shellTag  = regexp.MustCompile(`(?i)<(meta|link)\b[^>]*>`)
+	shellAttr = regexp.MustCompile(`([a-zA-Z][\w:-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// shellImage returns the image the SPA shell declares for previews: its
+// og:image, else its twitter:image, else its icon. It is "" if there is none.
+func shellImage(shell []byte) string {
+	var og, twitter, icon string
+	for _, tag := range shellTag.FindAllSubmatch(shell, -1) {
+		attrs := map[string]string{}
+		for _, a := range shellAttr.FindAllSubmatch(tag[0], -1) {
+			attrs[strings.ToLower(string(a[1]))] = html.UnescapeString(string(a[2]) + string(a[3]) + string(a[4]))
+		}
+		switch {
+		case strings.EqualFold(string(tag[1]), "link"):
+			if icon == "" && attrs["href"] != "" && slices.Contains(strings.Fields(strings.ToLower(attrs["rel"])), "icon") {
+				icon = attrs["href"]
+			}
+		case og == "" && attrs["property"] == "og:image":
+			og = attrs["content"]
+		case twitter == "" && attrs["name"] == "twitter:image":
+			twitter = attrs["content"]
+		}
+	}
+	for _, image := range []string{og, twitter, icon} {
+		if image != "" {
+			return image
+		}
+	}
+	return ""
+}
+
+// pageURL is the absolute URL of the page r asks for, which preview images
+// are resolved against since crawlers need them absolute. It is under
+// -public-url, or else under the Host r names, which the client chose.
+func (h *Hub) pageURL(r *http.Request) *url.URL {
+	if base, err := url.Parse(h.opts.PublicURL); err == nil && base.Host != "" {
+		return &url.URL{Scheme: base.Scheme, Host: base.Host, Path: r.URL.Path}
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}
+}
+
+// previewTags returns Open Graph and Twitter meta tags for a room, with image
+// as the preview image if it is not "". Private or unknown rooms get the
+// generic site tags so the page reveals nothing about whether they exist.
+func (h *Hub) previewTags(name, image string) string {
+	title, description := previewSiteName, previewDescription
+	if room := h.getRoom(name); room != nil {
+		room.mu.RLock()
+		if !room.private {
+			title = fmt.Sprintf("%s · %s", room.name, previewSiteName)
+			description = fmt.Sprintf("%d in the room right now. Join the conversation on %s.", len(room.clients), previewSiteName)
+			if room.topic != "" {
+				description = room.topic + " · " + description
+			}
+		}
+		room.mu.RUnlock()
+	}
+
+	var b strings.Builder
+	meta := func(attr, key, value string) {
+		fmt.Fprintf(&b, "<meta %s=\"%s\" content=\"%s\" />\n", attr, key, html.EscapeString(value))
+	}
+	meta("property", "og:site_name", previewSiteName)
+	meta("property", "og:type", "website")
+	meta("property", "og:title", title)
+	meta("property", "og:description", description)
+	if image != "" {
+		meta("property", "og:image", image)
+	}
+	meta("name", "twitter:card", "summary")
+	meta("name", "twitter:title", title)
+	meta("name", "twitter:description", description)
+	if image != "" {
+		meta("name", "twitter:image", image)
+	}
+	return b.String()
+}
+
+func (p *roomPreviewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	shell, err := fs.ReadFile(p.fsys, "index.html")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	image := shellImage(shell)
+	if image != "" {
+		if ref, err := url.Parse(image); err == nil {
+			image = p.hub.pageURL(r).ResolveReference(ref).String()
+		} else {
+			image = ""
+		}
+	}
+	tags := []byte(p.hub.previewTags(r.PathValue("name"), image))
+	if i := bytes.Index(shell, []byte("</head>")); i >= 0 {
+		shell = append(shell[:i:i], append(tags, shell[i:]...)...)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// A page built from the client's Host must not be served to others
+	// from a shared cache.
+	if p.hub.opts.PublicURL != "" {
+		w.Header().Set("Cache-Control", "public, max-age=30")
+	} else {
+		w.Header().Set("Cache-Control", "private, max-age=30")
+	}
+	w.Write(shell)
+}
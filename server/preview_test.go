@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestShellImage(t *testing.T) {
+	for _, tc := range []struct{ shell, want string }{
+		{`<head><link rel="icon" href="./favicon.svg"></head>`, "./favicon.svg"},
+		{`<head><LINK REL="shortcut icon" HREF='/f.ico' /></head>`, "/f.ico"},
+		{`<link rel="stylesheet" href="/app.css"><link rel=icon href=/f.png>`, "/f.png"},
+		{`<link rel="icon" href="/f.svg"><meta name="twitter:image" content="/card.png">`, "/card.png"},
+		{`<meta name="twitter:image" content="/card.png"><meta property="og:image" content="/og.png?a=1&amp;b=2">`, "/og.png?a=1&b=2"},
+		{`<head><title>TempChat</title></head>`, ""},
+	} {
+		if got := shellImage([]byte(tc.shell)); got != tc.want {
+			t.Errorf("shellImage(%s) = %q, want %q", tc.shell, got, tc.want)
+		}
+	}
+}
+
+func servePreview(t *testing.T, s *testServer, shell, target string) string {
+	t.Helper()
+	return previewResponse(s, shell, target).Body.String()
+}
+
+func previewResponse(s *testServer, shell, target string) *httptest.ResponseRecorder {
+	p := newRoomPreviewHandler(s.Hub, fstest.MapFS{"index.html": {Data: []byte(shell)}})
+	mux := http.NewServeMux()
+	mux.Handle("GET /room/{name}", p)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+	return rec
+}
+
+func TestPreviewPublicURL(t *testing.T) {
+	const shell = `<html><head><link rel="icon" href="/favicon.svg" /></head></html>`
+	for _, tc := range []struct {
+		publicURL, image, cache string
+	}{
+		{"", "http://spoofed.example/favicon.svg", "private, max-age=30"},
+		{"https://chat.example", "https://chat.example/favicon.svg", "public, max-age=30"},
+	} {
+		s := newTestServer(t, func(o *Options) { o.PublicURL = tc.publicURL })
+		rec := previewResponse(s, shell, "http://spoofed.example/room/lobby")
+		if tag := `<meta property="og:image" content="` + tc.image + `" />`; !strings.Contains(rec.Body.String(), tag) {
+			t.Errorf("-public-url %q: page lacks %s:\n%s", tc.publicURL, tag, rec.Body)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != tc.cache {
+			t.Errorf("-public-url %q: Cache-Control %q, want %q", tc.publicURL, got, tc.cache)
+		}
+	}
+	for _, bad := range []string{"chat.example", "ftp://chat.example", "https://chat.example/app"} {
+		opts := DefaultOptions()
+		opts.PublicURL = bad
+		if err := opts.validate(); err == nil {
+			t.Errorf("validate accepts -public-url %q", bad)
+		}
+	}
+}
+
+func TestPreviewImageResolvedAgainstPage(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.join(t, "action=create&room=lobby&username=alice&topic="+url.QueryEscape(`"quoted" <b>`))
+	for _, tc := range []struct{ href, want string }{
+		{"./_app/favicon.svg", "http://chat.example/room/_app/favicon.svg"},
+		{"/favicon.svg", "http://chat.example/favicon.svg"},
+		{"https://cdn.example/icon.png", "https://cdn.example/icon.png"},
+	} {
+		page := servePreview(t, s, `<html><head><link rel="icon" href="`+tc.href+`" /></head><body></body></html>`, "http://chat.example/room/lobby")
+		for _, tag := range []string{
+			`<meta property="og:image" content="` + tc.want + `" />`,
+			`<meta name="twitter:image" content="` + tc.want + `" />`,
+		} {
+			if !strings.Contains(page, tag) {
+				t.Errorf("icon %s: page lacks %s:\n%s", tc.href, tag, page)
+			}
+		}
+	}
+	page := servePreview(t, s, `<html><head></head></html>`, "http://chat.example/room/lobby")
+	if strings.Contains(page, "og:image") || strings.Contains(page, "twitter:image") {
+		t.Errorf("a shell without an image got image tags:\n%s", page)
+	}
+	if !strings.Contains(page, "&#34;quoted&#34; &lt;b&gt;") {
+		t.Errorf("topic not escaped:\n%s", page)
+	}
+}
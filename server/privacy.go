@@ -0,0 +1,129 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"chat/protocol"
+)
+
+// rejoinCodeTTL is how long the codes handed out by /private stay valid.
+const rejoinCodeTTL = 24 * time.Hour
+
+// rejoinCode is a code /private handed one member. It stands in for the
+// password once, for a join under that member's name.
+type rejoinCode struct {
+	name  string
+	spent bool
+}
+
+// privateCommand makes the room private with a new password in one step.
+// Members already inside stay connected; everyone but the owner is sent a
+// one-time code that stands in for the password if they drop and rejoin.
+// Invites issued while the room was open stop working.
+func (h *Hub) privateCommand(client *Client, arg string) string {
+	room := client.room
+	hash, err := hashPassword(arg)
+	if err != nil {
+		return "Failed to set the password."
+	}
+	room.mu.Lock()
+	if room.provisioned {
+		room.mu.Unlock()
+		return "This room's settings come from the rooms config."
+	}
+	room.private = true
+	room.password = hash
+	revoked := len(room.invites)
+	room.invites = nil
+	if room.rejoinCodes == nil {
+		room.rejoinCodes = make(map[[sha256.Size]byte]*rejoinCode)
+	}
+	codes := make(map[*Client]string, len(room.clients))
+	var minted [][sha256.Size]byte
+	for _, member := range room.clients {
+		if member == client {
+			continue
+		}
+		raw := make([]byte, 16)
+		if _, err := rand.Read(raw); err != nil {
+			panic(err)
+		}
+		code := hex.EncodeToString(raw)
+		sum := sha256.Sum256([]byte(code))
+		room.rejoinCodes[sum] = &rejoinCode{name: foldName(member.nick())}
+		minted = append(minted, sum)
+		codes[member] = code
+	}
+	room.mu.Unlock()
+	if len(minted) > 0 {
+		h.janitor.schedule("rejoin-codes", rejoinCodeTTL, func() {
+			room.mu.Lock()
+			for _, sum := range minted {
+				delete(room.rejoinCodes, sum)
+			}
+			room.mu.Unlock()
+		})
+	}
+	h.roomsChanged()
+
+	h.flushPresence(room)
+	h.broadcastToRoom(room, 0, newEnvelope(protocol.EventSystem, room, client.nick()+" made the room private. New members need the password.").Encode())
+	for member, code := range codes {
+		h.sendTo(member, newEnvelope(protocol.EventSystem, room, "If you are disconnected, rejoin as "+member.nick()+" with the password or this one-time code: "+code+" (valid for 24 hours).").Encode())
+	}
+	if revoked > 0 {
+		return "Revoked " + plural(revoked, "outstanding invite") + "."
+	}
+	return ""
+}
+
+// publicCommand lists the room again and drops its password, along with any
+// rejoin codes still outstanding.
+func (h *Hub) publicCommand(client *Client, arg string) string {
+	room := client.room
+	room.mu.Lock()
+	if room.provisioned {
+		room.mu.Unlock()
+		return "This room's settings come from the rooms config."
+	}
+	if !room.private && room.password == "" {
+		room.mu.Unlock()
+		return "This room is already public."
+	}
+	room.private = false
+	room.password = ""
+	room.rejoinCodes = nil
+	room.mu.Unlock()
+	h.roomsChanged()
+
+	h.flushPresence(room)
+	h.broadcastToRoom(room, 0, newEnvelope(protocol.EventSystem, room, client.nick()+" made the room public. It is listed again and no longer needs a password.").Encode())
+	return ""
+}
+
+// hasRejoinCode reports whether code is an unspent rejoin code handed to the
+// member called name. The caller holds r.mu.
+func (r *Room) hasRejoinCode(code, name string) bool {
+	rc := r.rejoinCodes[sha256.Sum256([]byte(code))]
+	return rc != nil && !rc.spent && rc.name == foldName(name)
+}
+
+// spendRejoinCode marks code used and reports whether a join as name may go
+// ahead: true for anything that is not a rejoin code, false for one already
+// spent or handed to someone else.
+func (r *Room) spendRejoinCode(code, name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rc := r.rejoinCodes[sha256.Sum256([]byte(code))]
+	if rc == nil {
+		return true
+	}
+	if rc.spent || rc.name != foldName(name) {
+		return false
+	}
+	rc.spent = true
+	return true
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// rejoinCodeFrom returns the code in the notice /private sends member.
+func rejoinCodeFrom(c *testConn) string {
+	c.t.Helper()
+	notice := c.nextSystem("one-time code: ")
+	return strings.Fields(strings.SplitN(notice.Body, "one-time code: ", 2)[1])[0]
+}
+
+// leave closes c and waits until the room has want members.
+func (s *testServer) leave(t *testing.T, c *testConn, room string, want int) {
+	t.Helper()
+	c.conn.Close()
+	waitFor(t, "the member to leave", func() bool { return s.memberCount(room) == want })
+}
+
+func TestRejoinAcrossPrivate(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner, _ := s.join(t, "action=create&room=club&username=owner")
+	bob, _ := s.join(t, "room=club&username=bob")
+	carol, _ := s.join(t, "room=club&username=carol")
+	s.join(t, "room=club&username=keeper")
+	owner.send("/private hunter2")
+	code := rejoinCodeFrom(bob)
+	s.leave(t, bob, "club", 3)
+	s.leave(t, carol, "club", 2)
+
+	if status := s.dialStatus(t, "room=club&username=mallory&password="+code); status != http.StatusUnauthorized {
+		t.Fatalf("bob's code under another name: status %d, want 401", status)
+	}
+	if status := s.dialStatus(t, "room=club&username=carol"); status != http.StatusUnauthorized {
+		t.Fatalf("rejoin without the password or a code: status %d, want 401", status)
+	}
+	s.join(t, "room=club&username=bob&password="+code)
+	s.join(t, "room=club&username=carol&password=hunter2")
+}
+
+func TestRejoinAcrossPublic(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner, _ := s.join(t, "action=create&room=club&username=owner")
+	bob, _ := s.join(t, "room=club&username=bob")
+	owner.send("/private hunter2")
+	code := rejoinCodeFrom(bob)
+	s.leave(t, bob, "club", 1)
+
+	owner.send("/public")
+	owner.nextSystem("made the room public")
+	s.join(t, "room=club&username=bob")
+	// Going private again does not bring the old code back.
+	owner.send("/private hunter3")
+	owner.nextSystem("made the room private")
+	if status := s.dialStatus(t, "room=club&username=bob&password="+code); status != http.StatusUnauthorized {
+		t.Fatalf("code from the earlier /private: status %d, want 401", status)
+	}
+}
+
+func TestPrivateRevokesInvites(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner, _ := s.join(t, "action=create&room=club&username=owner")
+	owner.send("/invite reusable")
+	notice := owner.nextSystem("invite=")
+	token := strings.SplitN(notice.Body, "invite=", 2)[1]
+	owner.send("/private hunter2")
+	owner.nextSystem("Revoked 1 outstanding invite.")
+
+	if status := s.dialStatus(t, "room=club&username=bob&invite="+token); status != http.StatusForbidden {
+		t.Fatalf("invite from before /private: status %d, want 403", status)
+	}
+	owner.send("/invite")
+	notice = owner.nextSystem("invite=")
+	s.join(t, "room=club&username=bob&invite="+strings.SplitN(notice.Body, "invite=", 2)[1])
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"chat/protocol"
+)
+
+// The wire format lives in the protocol package; these constructors fill in
+// the fields only the server knows.
+
+func newEnvelope(eventType string, room *Room, body string) protocol.Envelope {
+	return protocol.Envelope{Type: eventType, Room: room.name, Timestamp: time.Now().UTC(), Body: body}
+}
+
+func chatEnvelope(client *Client, body string) protocol.Envelope {
+	env := newEnvelope(protocol.EventChat, client.room, body)
+	env.Sender = client.nick()
+	env.SenderID = client.publicID
+	return env
+}
+
+func directEnvelope(client, target *Client, body string) protocol.Envelope {
+	env := chatEnvelope(client, body)
+	env.Type = protocol.EventDM
+	env.To = target.nick()
+	env.ToID = target.publicID
+	return env
+}
+
+func presenceEnvelope(eventType string, client *Client, body string, userCount int) protocol.Envelope {
+	env := newEnvelope(eventType, client.room, body)
+	env.Sender = client.nick()
+	env.SenderID = client.publicID
+	env.UserCount = &userCount
+	return env
+}
+
+func presenceBatchEnvelope(room *Room, events []protocol.Envelope) protocol.Envelope {
+	env := newEnvelope(protocol.EventPresence, room, "")
+	env.UserCount = events[len(events)-1].UserCount
+	env.Quiet = true
+	var lines []string
+	for _, event := range events {
+		env.Changes = append(env.Changes, protocol.PresenceChange{Type: event.Type, Sender: event.Sender, SenderID: event.SenderID, Quiet: event.Quiet})
+		if !event.Quiet {
+			env.Quiet = false
+			lines = append(lines, event.Body)
+		}
+	}
+	env.Body = strings.Join(lines, ", ")
+	return env
+}
+
+// helloEnvelope reads the room's state; the caller must hold its mu.
+func helloEnvelope(client *Client) protocol.Envelope {
+	env := newEnvelope(protocol.EventHello, client.room, "")
+	env.Sender = client.nick()
+	env.SenderID = client.publicID
+	env.ConnectionID = client.connID
+	env.Limits = client.room.rateProfile.limits()
+	env.Members = client.room.roster()
+	env.Seq = client.room.seq
+	env.OwnerCode = client.ownerCode
+	return env
+}
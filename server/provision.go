@@ -0,0 +1,295 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"chat/protocol"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// roomConfig is one entry of the -rooms-config file, which holds a JSON array
+// of these objects.
+type roomConfig struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Private  bool   `json:"private"`
+	// Class is provisioned, the default, or admin; see -reserved-admin.
+	Class string `json:"class"`
+	// RequireUsername turns away guests who have not chosen a name.
+	RequireUsername bool `json:"requireUsername"`
+	// Topic describes the room in the lobby, as ?topic= does for a room
+	// created at runtime.
+	Topic string `json:"topic"`
+	// Owners may take over the room's ownership by joining under their name
+	// with their password as ?owner=.
+	Owners []ownerConfig `json:"owners"`
+
+	line int
+}
+
+type ownerConfig struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+func lineAt(data []byte, offset int64) int {
+	pos := int(offset)
+	if pos > len(data) {
+		pos = len(data)
+	}
+	for pos < len(data) && strings.IndexByte(" \t\r\n,", data[pos]) >= 0 {
+		pos++
+	}
+	return bytes.Count(data[:pos], []byte("\n")) + 1
+}
+
+func decodeErrorLine(data []byte, err error, fallback int64) int {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return lineAt(data, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		return lineAt(data, typeErr.Offset)
+	}
+	return lineAt(data, fallback)
+}
+
+func parseRoomsConfig(data []byte) ([]roomConfig, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", decodeErrorLine(data, err, 0), err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("line %d: expected an array of rooms", lineAt(data, 0))
+	}
+
+	var rooms []roomConfig
+	seen := make(map[string]int)
+	for entry := 1; dec.More(); entry++ {
+		offset := dec.InputOffset()
+		var rc roomConfig
+		if err := dec.Decode(&rc); err != nil {
+			return nil, fmt.Errorf("line %d: entry %d: %v", decodeErrorLine(data, err, offset), entry, err)
+		}
+		rc.line = lineAt(data, offset)
+		rc.Name = strings.TrimSpace(rc.Name)
+		if rc.Name == "" {
+			return nil, fmt.Errorf("line %d: entry %d: name is required", rc.line, entry)
+		}
+		if prev, ok := seen[rc.Name]; ok {
+			return nil, fmt.Errorf("line %d: entry %d (%q): duplicate of the room on line %d", rc.line, entry, rc.Name, prev)
+		}
+		seen[rc.Name] = rc.line
+		rc.Topic = strings.TrimSpace(sanitizeText(rc.Topic))
+		if utf8.RuneCountInString(rc.Topic) > maxTopicLength {
+			return nil, fmt.Errorf("line %d: entry %d (%q): topic is over %d characters", rc.line, entry, rc.Name, maxTopicLength)
+		}
+		owners := make(map[string]bool, len(rc.Owners))
+		for i := range rc.Owners {
+			owner := &rc.Owners[i]
+			owner.Name = strings.TrimSpace(owner.Name)
+			switch {
+			case owner.Name == "":
+				return nil, fmt.Errorf("line %d: entry %d (%q): owner %d: name is required", rc.line, entry, rc.Name, i+1)
+			case owner.Password == "":
+				return nil, fmt.Errorf("line %d: entry %d (%q): owner %q: password is required", rc.line, entry, rc.Name, owner.Name)
+			case owners[owner.Name]:
+				return nil, fmt.Errorf("line %d: entry %d (%q): owner %q is listed twice", rc.line, entry, rc.Name, owner.Name)
+			}
+			owners[owner.Name] = true
+		}
+		switch rc.Class {
+		case "":
+			rc.Class = classProvisioned
+		case classProvisioned, classAdmin:
+		default:
+			return nil, fmt.Errorf("line %d: entry %d (%q): class must be %q or %q", rc.line, entry, rc.Name, classProvisioned, classAdmin)
+		}
+		rooms = append(rooms, rc)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("line %d: %v", decodeErrorLine(data, err, dec.InputOffset()), err)
+	}
+	return rooms, nil
+}
+
+func loadRoomsConfig(path string) ([]roomConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := parseRoomsConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rooms, nil
+}
+
+func passwordMatches(hash, password string) bool {
+	if hash == "" || password == "" {
+		return hash == "" && password == ""
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// rehash returns the hash to keep for password: current if it already
+// matches, else a new one. An empty password has an empty hash.
+func rehash(current, password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if passwordMatches(current, password) {
+		return current, nil
+	}
+	return hashPassword(password)
+}
+
+// configuredOwner reports whether name and password are those of one of the
+// room's configured owners.
+func (r *Room) configuredOwner(name, password string) bool {
+	r.mu.RLock()
+	hash, ok := r.owners[name]
+	r.mu.RUnlock()
+	return ok && passwordMatches(hash, password)
+}
+
+// provisionRooms creates or updates every configured room and releases
+// previously provisioned rooms that are no longer listed.
+func (h *Hub) provisionRooms(configs []roomConfig, closeRemoved bool) error {
+	hashes := make([]string, len(configs))
+	ownerHashes := make([]map[string]string, len(configs))
+	for i, rc := range configs {
+		var current string
+		var currentOwners map[string]string
+		if room := h.getRoom(rc.Name); room != nil {
+			room.mu.RLock()
+			current, currentOwners = room.password, room.owners
+			room.mu.RUnlock()
+		}
+		var err error
+		if hashes[i], err = rehash(current, rc.Password); err != nil {
+			return fmt.Errorf("line %d: room %q: %v", rc.line, rc.Name, err)
+		}
+		for _, owner := range rc.Owners {
+			hash, err := rehash(currentOwners[owner.Name], owner.Password)
+			if err != nil {
+				return fmt.Errorf("line %d: room %q: owner %q: %v", rc.line, rc.Name, owner.Name, err)
+			}
+			if ownerHashes[i] == nil {
+				ownerHashes[i] = make(map[string]string, len(rc.Owners))
+			}
+			ownerHashes[i][owner.Name] = hash
+		}
+	}
+
+	wanted := make(map[string]bool, len(configs))
+	var updated, removed []*Room
+
+	for i, rc := range configs {
+		wanted[rc.Name] = true
+		for {
+			fresh := h.newRoom(rc.Name, hashes[i], rc.Private)
+			fresh.provisioned = true
+			fresh.class = rc.Class
+			fresh.requireUsername = rc.RequireUsername
+			fresh.topic = rc.Topic
+			fresh.owners = ownerHashes[i]
+			if h.rooms.insert(fresh) {
+				h.usage.roomCreated()
+				break
+			}
+			room := h.rooms.get(rc.Name)
+			if room == nil {
+				// Removed between insert and get; try creating it again.
+				continue
+			}
+			room.mu.Lock()
+			changed := room.password != hashes[i] || room.private != rc.Private || room.requireUsername != rc.RequireUsername || room.topic != rc.Topic
+			room.password = hashes[i]
+			room.private = rc.Private
+			room.provisioned = true
+			room.class = rc.Class
+			room.requireUsername = rc.RequireUsername
+			room.topic = rc.Topic
+			room.owners = ownerHashes[i]
+			room.mu.Unlock()
+			if changed {
+				updated = append(updated, room)
+			}
+			break
+		}
+	}
+	h.rooms.each(func(room *Room) {
+		room.mu.Lock()
+		if room.provisioned && !wanted[room.name] {
+			room.provisioned = false
+			room.class = ""
+			room.owners = nil
+			removed = append(removed, room)
+		}
+		room.mu.Unlock()
+	})
+	for _, room := range removed {
+		h.removeRoom(room.name)
+	}
+	if len(removed) > 0 {
+		// Released rooms that still have members are now saved like any other.
+		h.roomsChanged()
+	}
+
+	for _, room := range updated {
+		h.broadcastToRoom(room, 0, newEnvelope(protocol.EventSystem, room, "Room settings were updated.").Encode())
+	}
+	if closeRemoved {
+		for _, room := range removed {
+			h.closeRoom(room, "This room has been closed.", "room closed")
+		}
+	}
+	return nil
+}
+
+// closeRoom notifies and drops every member with CloseGoingAway and reason;
+// once they are unregistered the empty room is removed as usual.
+func (h *Hub) closeRoom(room *Room, notice, reason string) {
+	h.broadcastToRoom(room, 0, newEnvelope(protocol.EventSystem, room, notice).Encode())
+	room.mu.RLock()
+	members := make([]*Client, 0, len(room.clients))
+	for _, client := range room.clients {
+		members = append(members, client)
+	}
+	room.mu.RUnlock()
+	for _, client := range members {
+		h.dropMember(client, websocket.CloseGoingAway, reason)
+	}
+}
+
+// ReloadRoomsConfig reconciles the rooms with Options.RoomsConfig again, as
+// the server does on SIGHUP. If the file is invalid the current rooms are
+// kept and the error returned.
+func (h *Hub) ReloadRoomsConfig() error {
+	if h.opts.RoomsConfig == "" {
+		return nil
+	}
+	configs, err := loadRoomsConfig(h.opts.RoomsConfig)
+	if err != nil {
+		return err
+	}
+	if err := h.provisionRooms(configs, h.opts.RoomsConfigCloseRemoved); err != nil {
+		return err
+	}
+	log.Printf("Reloaded %d rooms from %s", len(configs), h.opts.RoomsConfig)
+	return nil
+}
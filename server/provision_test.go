@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseRoomsConfigTopicAndOwners(t *testing.T) {
+	rooms, err := parseRoomsConfig([]byte(`[
+  {"name": "billing", "topic": "  Invoices and refunds ", "owners": [{"name": " dana ", "password": "pw"}]}
+]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc := rooms[0]; rc.Topic != "Invoices and refunds" || len(rc.Owners) != 1 || rc.Owners[0].Name != "dana" {
+		t.Fatalf("parsed %+v", rc)
+	}
+
+	for _, tc := range []struct{ config, want string }{
+		{`[{"name": "a"},
+  {"name": "b", "topic": "` + strings.Repeat("x", maxTopicLength+1) + `"}]`, `line 2: entry 2 ("b"): topic is over`},
+		{`[{"name": "a", "owners": [{"password": "pw"}]}]`, `line 1: entry 1 ("a"): owner 1: name is required`},
+		{`[{"name": "a", "owners": [{"name": "dana"}]}]`, `owner "dana": password is required`},
+		{`[{"name": "a", "owners": [{"name": "dana", "password": "x"}, {"name": "dana", "password": "y"}]}]`, `owner "dana" is listed twice`},
+	} {
+		if _, err := parseRoomsConfig([]byte(tc.config)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parseRoomsConfig(%s) = %v, want an error containing %q", tc.config, err, tc.want)
+		}
+	}
+}
+
+func TestProvisionedTopicAndOwners(t *testing.T) {
+	s := newTestServer(t, nil)
+	configs, err := parseRoomsConfig([]byte(`[{"name": "billing", "topic": "Invoices", "owners": [{"name": "dana", "password": "owner-pw"}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.provisionRooms(configs, false); err != nil {
+		t.Fatal(err)
+	}
+
+	visitor, _ := s.join(t, "room=billing&username=visitor")
+	visitor.nextSystem("Topic: Invoices")
+	visitor.send("/invite")
+	visitor.nextSystem("Only the room owner")
+
+	for _, query := range []string{
+		"room=billing&username=dana&owner=wrong",
+		"room=billing&username=mallory&owner=owner-pw",
+		"room=billing&owner=owner-pw",
+	} {
+		if status := s.dialStatus(t, query); status != http.StatusUnauthorized {
+			t.Fatalf("%s: status %d, want 401", query, status)
+		}
+	}
+	dana, _ := s.join(t, "room=billing&username=dana&owner=owner-pw")
+	dana.send("/invite")
+	dana.nextSystem("Single-use invite")
+
+	room := s.getRoom("billing")
+	room.mu.RLock()
+	hash := room.owners["dana"]
+	room.mu.RUnlock()
+	configs[0].Topic = "Invoices and refunds"
+	if err := s.provisionRooms(configs, false); err != nil {
+		t.Fatal(err)
+	}
+	visitor.nextSystem("Room settings were updated.")
+	room.mu.RLock()
+	topic, rehashed := room.topic, room.owners["dana"] != hash
+	room.mu.RUnlock()
+	if topic != "Invoices and refunds" || rehashed {
+		t.Fatalf("after reload: topic %q, owner password rehashed %v; want the new topic and the old hash", topic, rehashed)
+	}
+}
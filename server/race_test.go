@@ -0,0 +1,6 @@
+//go:build race
+
+package server
+
+// raceEnabled is set under -race, whose instrumentation allocates.
+const raceEnabled = true
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"chat/protocol"
+)
+
+const strikeWindow = time.Minute
+
+// rateProfile is the per-connection limit a room applies to its members.
+type rateProfile struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+func (p rateProfile) String() string {
+	return fmt.Sprintf("%s (%g messages/s, burst %d)", p.Name, p.Rate, p.Burst)
+}
+
+// namedProfile returns one of the built-in profiles, held to the ceilings.
+func (o *Options) namedProfile(name string) (rateProfile, bool) {
+	var p rateProfile
+	switch name {
+	case "relaxed":
+		p = rateProfile{name, o.MsgRate * 2, o.MsgBurst * 2}
+	case "standard":
+		p = rateProfile{name, o.MsgRate, o.MsgBurst}
+	case "strict":
+		p = rateProfile{name, o.MsgRate / 5, max(o.MsgBurst/3, 1)}
+	default:
+		return rateProfile{}, false
+	}
+	p.Rate = min(p.Rate, o.MaxMsgRate)
+	p.Burst = min(p.Burst, o.MaxMsgBurst)
+	return p, true
+}
+
+// customProfile validates owner-chosen values against the ceilings.
+func (o *Options) customProfile(rate, burst string) (rateProfile, error) {
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r <= 0 || r > o.MaxMsgRate {
+		return rateProfile{}, fmt.Errorf("rate must be above 0 and at most %g", o.MaxMsgRate)
+	}
+	b, err := strconv.Atoi(burst)
+	if err != nil || b < 1 || b > o.MaxMsgBurst {
+		return rateProfile{}, fmt.Errorf("burst must be from 1 to %d", o.MaxMsgBurst)
+	}
+	return rateProfile{"custom", r, b}, nil
+}
+
+func (p rateProfile) limits() *protocol.Limits {
+	return &protocol.Limits{Profile: p.Name, MessagesPerSecond: p.Rate, MessageBurst: p.Burst}
+}
+
+func (o *Options) startingProfile() rateProfile {
+	p, _ := o.namedProfile(o.RateProfile)
+	return p
+}
+
+// tokenBucket allows burst events at once and rate per second after that.
+// Callers pass the time so it can be driven without a clock.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) tokenBucket {
+	return tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// retune switches the bucket to new limits, keeping the same fraction of
+// the burst available so nobody is refilled or emptied by the change.
+func (b *tokenBucket) retune(now time.Time, rate float64, burst int) {
+	b.refill(now)
+	b.tokens = b.tokens / b.burst * float64(burst)
+	b.rate = rate
+	b.burst = float64(burst)
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve takes a token now or, if none is left, books the next one and
+// returns how long to wait for it. It refuses bookings further out than
+// maxWait.
+func (b *tokenBucket) reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > maxWait {
+		return 0, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// roomBucket is the tokenBucket shared by a room's read loops.
+type roomBucket struct {
+	mu sync.Mutex
+	tokenBucket
+}
+
+func (b *roomBucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokenBucket.allow(now)
+}
+
+// inboundLimiter is one connection's view of the limits. It is used only by
+// that connection's read loop.
+type inboundLimiter struct {
+	client     tokenBucket
+	profile    rateProfile
+	room       *roomBucket
+	warned     bool
+	maxStrikes int
+	strikes    int
+	lastStrike time.Time
+}
+
+type limitVerdict int
+
+const (
+	limitAllow limitVerdict = iota
+	limitDrop
+	limitWarnClient
+	limitWarnRoom
+	limitDisconnect
+)
+
+func newInboundLimiter(room *Room, profile rateProfile, maxStrikes int) *inboundLimiter {
+	return &inboundLimiter{client: newTokenBucket(profile.Rate, profile.Burst), profile: profile, room: &room.limiter, maxStrikes: maxStrikes}
+}
+
+// check decides what happens to a frame read at now under the room's current
+// profile. Only the first frame dropped in a run is answered with a warning,
+// and each such warning is a strike against the connection; strikes are
+// forgotten after a quiet minute.
+func (l *inboundLimiter) check(now time.Time, profile rateProfile) limitVerdict {
+	if profile != l.profile {
+		l.client.retune(now, profile.Rate, profile.Burst)
+		l.profile = profile
+	}
+	if !l.client.allow(now) {
+		if l.warned {
+			return limitDrop
+		}
+		l.warned = true
+		if now.Sub(l.lastStrike) > strikeWindow {
+			l.strikes = 0
+		}
+		l.strikes++
+		l.lastStrike = now
+		if l.strikes > l.maxStrikes {
+			return limitDisconnect
+		}
+		return limitWarnClient
+	}
+	if !l.room.allow(now) {
+		if l.warned {
+			return limitDrop
+		}
+		l.warned = true
+		return limitWarnRoom
+	}
+	l.warned = false
+	return limitAllow
+}
+
+// available is how many frames could be sent at now without waiting.
+func (l *inboundLimiter) available(now time.Time) int {
+	l.client.refill(now)
+	return int(l.client.tokens)
+}
+
+// currentStrikes is the strike count as check would see it at now.
+func (l *inboundLimiter) currentStrikes(now time.Time) int {
+	if now.Sub(l.lastStrike) > strikeWindow {
+		return 0
+	}
+	return l.strikes
+}
+
+func (r *Room) currentRateProfile() rateProfile {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rateProfile
+}
+
+const rateLimitUsage = "/ratelimit relaxed|standard|strict|custom RATE BURST"
+
+// rateLimitCommand lets the owner pick a named profile or custom values.
+func (h *Hub) rateLimitCommand(client *Client, arg string) string {
+	room := client.room
+	fields := strings.Fields(arg)
+	profile, ok := h.opts.namedProfile(fields[0])
+	if !ok {
+		if fields[0] != "custom" || len(fields) != 3 {
+			return "Usage: " + rateLimitUsage
+		}
+		var err error
+		if profile, err = h.opts.customProfile(fields[1], fields[2]); err != nil {
+			return "Invalid rate limit: " + err.Error() + "."
+		}
+	}
+	room.mu.Lock()
+	room.rateProfile = profile
+	room.mu.Unlock()
+	env := newEnvelope(protocol.EventLimits, room, "Rate limit set to "+profile.String()+" by "+client.nick()+".")
+	env.Limits = profile.limits()
+	h.flushPresence(room)
+	h.broadcastToRoom(room, 0, env.Encode())
+	return ""
+}
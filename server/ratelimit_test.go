@@ -0,0 +1,135 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+var limiterStart = time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(2, 3)
+	now := limiterStart
+	for i := range 3 {
+		if !b.allow(now) {
+			t.Fatalf("frame %d of the burst refused", i+1)
+		}
+	}
+	if b.allow(now) {
+		t.Fatal("frame past the burst allowed")
+	}
+	now = now.Add(500 * time.Millisecond)
+	if !b.allow(now) || b.allow(now) {
+		t.Fatal("half a second at 2/s should refill exactly one token")
+	}
+	// A long quiet spell refills no more than the burst.
+	now = now.Add(time.Hour)
+	for range 3 {
+		b.allow(now)
+	}
+	if b.allow(now) {
+		t.Fatal("refilled past the burst")
+	}
+}
+
+func TestTokenBucketRetune(t *testing.T) {
+	b := newTokenBucket(1, 10)
+	for range 5 {
+		b.allow(limiterStart)
+	}
+	b.retune(limiterStart, 1, 4)
+	if b.tokens != 2 {
+		t.Fatalf("tokens = %g after retuning half a burst of 10 to 4, want 2", b.tokens)
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	b := newTokenBucket(4, 1)
+	if wait, ok := b.reserve(limiterStart, time.Second); !ok || wait != 0 {
+		t.Fatalf("reserve = %v, %v; want a token now", wait, ok)
+	}
+	if wait, ok := b.reserve(limiterStart, time.Second); !ok || wait != 250*time.Millisecond {
+		t.Fatalf("reserve = %v, %v; want 250ms", wait, ok)
+	}
+	if _, ok := b.reserve(limiterStart, 100*time.Millisecond); ok {
+		t.Fatal("booked a token further out than maxWait")
+	}
+}
+
+func testLimiter(profile rateProfile, roomBurst, maxStrikes int) (*inboundLimiter, *Room) {
+	room := &Room{limiter: roomBucket{tokenBucket: newTokenBucket(1000, roomBurst)}}
+	return newInboundLimiter(room, profile, maxStrikes), room
+}
+
+func TestInboundLimiterWarnsOncePerRun(t *testing.T) {
+	profile := rateProfile{"test", 1, 2}
+	l, _ := testLimiter(profile, 100, 5)
+	now := limiterStart
+	want := []limitVerdict{limitAllow, limitAllow, limitWarnClient, limitDrop, limitDrop}
+	for i, w := range want {
+		if got := l.check(now, profile); got != w {
+			t.Fatalf("frame %d: verdict %d, want %d", i+1, got, w)
+		}
+	}
+	now = now.Add(time.Second)
+	if got := l.check(now, profile); got != limitAllow {
+		t.Fatalf("after refilling: verdict %d, want allow", got)
+	}
+	if got := l.check(now, profile); got != limitWarnClient {
+		t.Fatalf("next run: verdict %d, want a fresh warning", got)
+	}
+}
+
+func TestInboundLimiterStrikesOut(t *testing.T) {
+	profile := rateProfile{"test", 1, 1}
+	l, _ := testLimiter(profile, 100, 2)
+	now := limiterStart
+	var last limitVerdict
+	for range 3 {
+		l.check(now, profile)
+		last = l.check(now, profile)
+		now = now.Add(time.Second)
+	}
+	if last != limitDisconnect {
+		t.Fatalf("third strike: verdict %d, want disconnect", last)
+	}
+
+	// Strikes a quiet minute apart are forgotten.
+	l, _ = testLimiter(profile, 100, 2)
+	now = limiterStart
+	for range 3 {
+		l.check(now, profile)
+		last = l.check(now, profile)
+		now = now.Add(2 * strikeWindow)
+	}
+	if last != limitWarnClient {
+		t.Fatalf("spaced strikes: verdict %d, want a warning", last)
+	}
+}
+
+func TestInboundLimiterRoomCap(t *testing.T) {
+	profile := rateProfile{"test", 100, 100}
+	a, room := testLimiter(profile, 3, 5)
+	b := newInboundLimiter(room, profile, 5)
+	for _, l := range []*inboundLimiter{a, b, a} {
+		if got := l.check(limiterStart, profile); got != limitAllow {
+			t.Fatalf("verdict %d within the room's burst, want allow", got)
+		}
+	}
+	if got := b.check(limiterStart, profile); got != limitWarnRoom {
+		t.Fatalf("verdict %d past the room's burst, want a room warning", got)
+	}
+}
+
+func TestInboundLimiterFollowsProfile(t *testing.T) {
+	relaxed := rateProfile{"relaxed", 10, 10}
+	strict := rateProfile{"strict", 1, 1}
+	l, _ := testLimiter(relaxed, 100, 5)
+	if got := l.available(limiterStart); got != 10 {
+		t.Fatalf("available = %d, want 10", got)
+	}
+	l.check(limiterStart, strict)
+	if got := l.check(limiterStart, strict); got != limitWarnClient {
+		t.Fatalf("verdict %d under the stricter profile, want a warning", got)
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"chat/protocol"
+)
+
+const (
+	minReminder = time.Minute
+	maxReminder = 24 * time.Hour
+	remindUsage = "/remind DURATION text, e.g. /remind 20m check the oven"
+)
+
+type reminder struct {
+	n     int
+	due   time.Time
+	text  string
+	entry *janitorEntry
+}
+
+// reminderList is a connection's pending reminders. It is shared by the read
+// loop and the janitor, hence its own lock.
+type reminderList struct {
+	mu      sync.Mutex
+	pending []*reminder
+	next    int
+}
+
+func (l *reminderList) remove(n int) *reminder {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, r := range l.pending {
+		if r.n == n {
+			l.pending = append(l.pending[:i], l.pending[i+1:]...)
+			return r
+		}
+	}
+	return nil
+}
+
+// heldReminder is a reminder waiting, across a restart, for the member who
+// set it to rejoin under the same name. Only members with a name of their
+// own get one; a guest's name does not come back.
+type heldReminder struct {
+	name  string
+	due   time.Time
+	text  string
+	entry *janitorEntry
+}
+
+// remindCommand schedules text to come back to the sender alone later. A
+// reminder lives only as long as the membership that set it, except that
+// with -persist a restart holds it for the member's return; see
+// holdReminders.
+func (h *Hub) remindCommand(client *Client, arg string) string {
+	spec, text, _ := strings.Cut(arg, " ")
+	text = strings.Trim(strings.TrimSpace(text), `"`)
+	d, err := time.ParseDuration(spec)
+	if err != nil || text == "" {
+		return "Usage: " + remindUsage
+	}
+	if d < minReminder || d > maxReminder {
+		return fmt.Sprintf("Reminders must be from %v to %v away.", minReminder, maxReminder)
+	}
+	l := &client.reminders
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) >= h.opts.MaxReminders {
+		return fmt.Sprintf("You already have %d reminders pending.", len(l.pending))
+	}
+	l.next++
+	r := &reminder{n: l.next, due: h.janitor.clock.Now().Add(d), text: text}
+	r.entry = h.janitor.schedule("reminder", d, func() { h.deliverReminder(client, r.n) })
+	l.pending = append(l.pending, r)
+	h.roomsChanged()
+	return fmt.Sprintf("Reminder %d set for %s.", r.n, r.due.UTC().Format("15:04 MST"))
+}
+
+func (h *Hub) deliverReminder(client *Client, n int) {
+	r := client.reminders.remove(n)
+	if r == nil {
+		return
+	}
+	h.roomsChanged()
+	if !h.sendTo(client, newEnvelope(protocol.EventSystem, client.room, "Reminder: "+r.text).Encode()) {
+		log.Printf("conn=%s reminder missed, %d missed so far", client.connID, h.remindersMissed.Add(1))
+	}
+}
+
+func (h *Hub) remindersCommand(client *Client, arg string) string {
+	l := &client.reminders
+	if arg == "" {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if len(l.pending) == 0 {
+			return "You have no reminders pending."
+		}
+		now := h.janitor.clock.Now()
+		lines := make([]string, len(l.pending))
+		for i, r := range l.pending {
+			lines[i] = fmt.Sprintf("%d: in %v, %s", r.n, r.due.Sub(now).Round(time.Second), r.text)
+		}
+		return "Pending reminders:\n" + strings.Join(lines, "\n")
+	}
+	spec, ok := strings.CutPrefix(arg, "cancel ")
+	n, err := strconv.Atoi(strings.TrimSpace(spec))
+	if !ok || err != nil {
+		return "Usage: /reminders [cancel N]"
+	}
+	r := l.remove(n)
+	if r == nil {
+		return fmt.Sprintf("You have no reminder %d.", n)
+	}
+	h.janitor.cancel(r.entry)
+	h.roomsChanged()
+	return fmt.Sprintf("Reminder %d cancelled.", n)
+}
+
+// cancelReminders drops everything client has pending, for bans and once it
+// leaves the room.
+func (h *Hub) cancelReminders(client *Client) {
+	l := &client.reminders
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+	for _, r := range pending {
+		h.janitor.cancel(r.entry)
+	}
+}
+
+// holdReminders moves the named members' pending reminders onto their room,
+// so the shutdown closing their connections does not lose them. Drain calls
+// it with -persist, before closing anything.
+func (h *Hub) holdReminders(room *Room) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	for _, client := range room.clients {
+		if client.guest {
+			continue
+		}
+		l := &client.reminders
+		l.mu.Lock()
+		for _, r := range l.pending {
+			room.reminders = append(room.reminders, &heldReminder{name: foldName(client.nick()), due: r.due, text: r.text})
+		}
+		l.mu.Unlock()
+		h.cancelReminders(client)
+	}
+}
+
+// restoreReminder holds a saved reminder on room until its member rejoins.
+// One still held when due is missed.
+func (h *Hub) restoreReminder(room *Room, name string, due time.Time, text string) {
+	held := &heldReminder{name: foldName(name), due: due, text: text}
+	held.entry = h.janitor.schedule("reminder", due.Sub(h.janitor.clock.Now()), func() {
+		room.mu.Lock()
+		i := slices.Index(room.reminders, held)
+		if i >= 0 {
+			room.reminders = slices.Delete(room.reminders, i, i+1)
+		}
+		room.mu.Unlock()
+		if i >= 0 {
+			h.roomsChanged()
+			log.Printf("room=%q reminder for %q missed, %d missed so far", room.name, name, h.remindersMissed.Add(1))
+		}
+	})
+	room.reminders = append(room.reminders, held)
+}
+
+// adoptReminders gives client the reminders held for its name. The caller
+// holds client.room.mu for writing.
+func (h *Hub) adoptReminders(client *Client) {
+	room := client.room
+	if client.guest || len(room.reminders) == 0 {
+		return
+	}
+	name := foldName(client.nick())
+	now := h.janitor.clock.Now()
+	l := &client.reminders
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	kept := room.reminders[:0]
+	for _, held := range room.reminders {
+		if held.name != name || !h.janitor.cancel(held.entry) {
+			kept = append(kept, held)
+			continue
+		}
+		l.next++
+		r := &reminder{n: l.next, due: held.due, text: held.text}
+		r.entry = h.janitor.schedule("reminder", held.due.Sub(now), func() { h.deliverReminder(client, r.n) })
+		l.pending = append(l.pending, r)
+	}
+	clear(room.reminders[len(kept):])
+	room.reminders = kept
+}
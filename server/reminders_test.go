@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/protocol"
+)
+
+func TestRemindersEndWithTheMembership(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.join(t, "action=create&room=side&username=bob")
+	alice, _ := s.join(t, "room=lobby&username=alice")
+	alice.sendFrame(protocol.Inbound{Type: protocol.TypeJoin, Room: "side"})
+	waitFor(t, "alice to join side", func() bool { return s.memberCount("side") == 2 })
+
+	alice.sendFrame(protocol.Inbound{Type: protocol.EventChat, Room: "side", Body: "/remind 5m stretch"})
+	alice.nextSystem("Reminder 1 set")
+	alice.send("/remind 5m lobby reminder")
+	alice.nextSystem("Reminder 1 set")
+	if got := s.janitor.pending("reminder"); got != 2 {
+		t.Fatalf("%d reminders pending, want 2", got)
+	}
+
+	alice.sendFrame(protocol.Inbound{Type: protocol.TypeLeave, Room: "side"})
+	waitFor(t, "the side reminder to be cancelled", func() bool { return s.janitor.pending("reminder") == 1 })
+	alice.conn.Close()
+	waitFor(t, "every reminder to be cancelled", func() bool { return s.janitor.pending("reminder") == 0 })
+}
+
+func TestReminderDelivered(t *testing.T) {
+	s := newTestServer(t, nil)
+	alice, _ := s.join(t, "room=lobby&username=alice")
+	alice.send("/remind 2m tea")
+	alice.nextSystem("Reminder 1 set")
+	s.clock.Advance(2 * time.Minute)
+	if got := alice.nextSystem("Reminder: "); got.Body != "Reminder: tea" {
+		t.Fatalf("reminder = %q", got.Body)
+	}
+}
+
+func TestRemindersSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+	withPersist := func(o *Options) { o.Persist = path }
+
+	before := newTestServer(t, withPersist)
+	alice, _ := before.join(t, "room=lobby&username=alice")
+	dave, _ := before.join(t, "room=lobby&username=dave")
+	guest, _ := before.join(t, "room=lobby")
+	alice.send("/remind 10m tea")
+	alice.nextSystem("Reminder 1 set")
+	dave.send("/remind 5m stretch")
+	dave.nextSystem("Reminder 1 set")
+	guest.send("/remind 5m gone with the guest")
+	guest.nextSystem("Reminder 1 set")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	before.Drain(ctx)
+	if saved := readSaved(path); len(saved) != 1 || len(saved[0].Reminders) != 2 {
+		t.Fatalf("saved %+v, want lobby with alice's and dave's reminders", saved)
+	}
+
+	after := newTestServer(t, withPersist)
+	if got := after.janitor.pending("reminder"); got != 2 {
+		t.Fatalf("%d reminders restored, want 2", got)
+	}
+	alice, _ = after.join(t, "room=lobby&username=alice")
+	alice.send("/reminders")
+	if got := alice.nextSystem("Pending reminders"); !strings.Contains(got.Body, "1: in 10m0s, tea") {
+		t.Fatalf("/reminders after the restart = %q", got.Body)
+	}
+	after.clock.Advance(5 * time.Minute)
+	waitFor(t, "dave's reminder to be missed", func() bool { return after.remindersMissed.Load() == 1 })
+	after.clock.Advance(5 * time.Minute)
+	if got := alice.nextSystem("Reminder: "); got.Body != "Reminder: tea" {
+		t.Fatalf("reminder = %q", got.Body)
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"slices"
+	"time"
+
+	"chat/protocol"
+)
+
+// historyWindowBytes bounds the chat frames one history event carries.
+const historyWindowBytes = 32 << 10
+
+// joinFrames is how many frames a join queues besides replay: the hello and
+// the topic.
+const joinFrames = 2
+
+type replayEntry struct {
+	seq  uint64
+	env  protocol.Envelope
+	data []byte
+}
+
+// replayBuffer keeps a room's most recent chat frames for members rejoining
+// with ?since=. It is a ring: once full, next is also the oldest entry.
+type replayBuffer struct {
+	entries []replayEntry
+	next    int
+}
+
+func (b *replayBuffer) add(size int, e replayEntry) {
+	if size <= 0 {
+		return
+	}
+	if len(b.entries) < size {
+		b.entries = append(b.entries, e)
+		return
+	}
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+}
+
+// since returns the buffered frames numbered after seq, oldest first.
+func (b *replayBuffer) since(seq uint64) [][]byte {
+	var frames [][]byte
+	for i := range b.entries {
+		e := b.entries[(b.next+i)%len(b.entries)]
+		if e.seq > seq {
+			frames = append(frames, e.data)
+		}
+	}
+	return frames
+}
+
+// envelopes returns the buffered events, oldest first.
+func (b *replayBuffer) envelopes() []protocol.Envelope {
+	envs := make([]protocol.Envelope, len(b.entries))
+	for i := range b.entries {
+		envs[i] = b.entries[(b.next+i)%len(b.entries)].env
+	}
+	return envs
+}
+
+// window returns the newest buffered events numbered above floor and below
+// before that fit in historyWindowBytes, oldest first, and whether older ones
+// remain. It always returns at least one event if there is any.
+func (b *replayBuffer) window(floor, before uint64) (envs []protocol.Envelope, more bool) {
+	size := 0
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		e := b.entries[(b.next+i)%len(b.entries)]
+		if e.seq <= floor || e.seq >= before {
+			continue
+		}
+		if len(envs) > 0 && size+len(e.data) > historyWindowBytes {
+			more = true
+			break
+		}
+		size += len(e.data)
+		envs = append(envs, e.env)
+	}
+	slices.Reverse(envs)
+	return envs, more
+}
+
+// sequence numbers and timestamps a chat event for room, keeps it for replay,
+// marks it for saving with -persist and returns it encoded.
+func (h *Hub) sequence(room *Room, env *protocol.Envelope) []byte {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	room.seq++
+	env.Seq = room.seq
+	env.Timestamp = time.Now().UTC()
+	data := env.Encode()
+	room.replay.add(h.opts.ReplayBuffer, replayEntry{room.seq, *env, data})
+	h.roomsChanged()
+	return data
+}
+
+// replayTo queues the frames client missed since the sequence number it
+// rejoined with. A number past the room's own means the room was removed and
+// created again since, so everything buffered is new to the client. A
+// windowed client gets only the newest history window now and asks for the
+// rest with history_more. The caller holds room.mu for writing.
+func (h *Hub) replayTo(client *Client, room *Room) {
+	if !client.replay {
+		return
+	}
+	if client.since > room.seq {
+		client.since = 0
+	}
+	if client.windowed {
+		client.enqueue(historyEnvelope(room, client.since, room.seq+1).Encode())
+		return
+	}
+	for _, data := range room.replay.since(client.since) {
+		client.enqueue(data)
+	}
+}
+
+// historyEnvelope is the history window below before for a client that has
+// everything up to floor. The caller holds room.mu.
+func historyEnvelope(room *Room, floor, before uint64) protocol.Envelope {
+	env := newEnvelope(protocol.EventHistory, room, "")
+	env.History, env.More = room.replay.window(floor, before)
+	return env
+}
+
+// sendHistoryMore answers a windowed client's history_more frame with the
+// window below before. It runs on the client's read loop; the room's read
+// lock keeps the buffer and the client's floor steady meanwhile.
+func (h *Hub) sendHistoryMore(client *Client, before uint64) {
+	room := client.room
+	room.mu.RLock()
+	if !client.windowed {
+		room.mu.RUnlock()
+		return
+	}
+	env := historyEnvelope(room, client.since, before)
+	room.mu.RUnlock()
+	h.sendTo(client, env.Encode())
+}
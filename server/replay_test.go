@@ -0,0 +1,196 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+func withHistory(o *Options) {
+	o.ReplayBuffer, o.SendBuffer = 200, 512
+	o.MsgBurst, o.MaxMsgBurst, o.RoomMsgBurst = 1000, 1000, 1000
+}
+
+// fillHistory has a member send n chat messages of about 1KB each to room and
+// waits for a second member to see the last of them.
+func (s *testServer) fillHistory(t *testing.T, room string, n int) *testConn {
+	t.Helper()
+	sender, _ := s.join(t, "room="+room+"&username=sender")
+	watcher, _ := s.join(t, "room="+room+"&username=watcher")
+	filler := strings.Repeat("x", 1000)
+	for i := 1; i <= n; i++ {
+		sender.send(fmt.Sprintf("%d %s", i, filler))
+	}
+	for {
+		if got := watcher.next(protocol.EventChat); got.Seq == uint64(n) {
+			return sender
+		}
+	}
+}
+
+func TestReplaySince(t *testing.T) {
+	s := newTestServer(t, withHistory)
+	s.fillHistory(t, "lobby", 20)
+	late, _ := s.join(t, "room=lobby&username=late&since=15")
+	for want := uint64(16); want <= 20; want++ {
+		if got := late.next(protocol.EventChat); got.Seq != want {
+			t.Fatalf("replayed seq %d, want %d", got.Seq, want)
+		}
+	}
+}
+
+func TestWindowedHistory(t *testing.T) {
+	s := newTestServer(t, withHistory)
+	const sent = 150
+	sender := s.fillHistory(t, "lobby", sent)
+
+	late, _ := s.join(t, "room=lobby&username=late&since=0&history=windowed")
+	first := late.next(protocol.EventHistory)
+	if !first.More || len(first.History) == 0 || first.History[len(first.History)-1].Seq != sent {
+		t.Fatalf("first window has %d events, more=%v; want the newest, with more to come", len(first.History), first.More)
+	}
+	if size := len(first.Encode()); size > historyWindowBytes+4096 {
+		t.Fatalf("first window is %d bytes, want about %d", size, historyWindowBytes)
+	}
+
+	// A message sent mid-replay arrives live and never in an older window.
+	sender.send("live")
+	if got := late.next(protocol.EventChat); got.Body != "live" || got.Seq != sent+1 {
+		t.Fatalf("live chat = %+v", got)
+	}
+
+	windows := 1
+	seen := first.History
+	for before, more := first.History[0].Seq, first.More; more; windows++ {
+		late.sendFrame(protocol.Inbound{Type: protocol.TypeHistoryMore, Before: before})
+		env := late.next(protocol.EventHistory)
+		if len(env.History) == 0 {
+			t.Fatalf("history_more before %d returned no events", before)
+		}
+		seen = append(env.History, seen...)
+		before, more = env.History[0].Seq, env.More
+	}
+	if windows < 3 {
+		t.Fatalf("%d messages of 1KB came in %d windows, want them split", sent, windows)
+	}
+	if len(seen) != sent {
+		t.Fatalf("windows held %d events, want %d", len(seen), sent)
+	}
+	for i, env := range seen {
+		if env.Seq != uint64(i+1) || env.Type != protocol.EventChat || env.Sender != "sender" {
+			t.Fatalf("event %d = %+v, want chat seq %d", i, env, i+1)
+		}
+	}
+}
+
+func TestHistoryMoreNeedsWindowedJoin(t *testing.T) {
+	s := newTestServer(t, withHistory)
+	sender := s.fillHistory(t, "lobby", 5)
+	late, _ := s.join(t, "room=lobby&username=late")
+	late.sendFrame(protocol.Inbound{Type: protocol.TypeHistoryMore, Before: 6})
+	sender.send("after")
+	for {
+		env, err := late.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.Type == protocol.EventHistory {
+			t.Fatalf("plain join got history %+v", env)
+		}
+		if env.Type == protocol.EventChat && env.Body == "after" {
+			return
+		}
+	}
+}
+
+// BenchmarkReplay500 compares replaying 500 buffered messages as single chat
+// frames against the first window a windowed client renders from. It reports
+// the frames sent on join and the bytes sent before the newest message can
+// be shown.
+func BenchmarkReplay500(b *testing.B) {
+	opts := DefaultOptions()
+	opts.ReplayBuffer, opts.SendBuffer = 500, 1024
+	h, err := newHub(opts, newFakeClock())
+	if err != nil {
+		b.Fatalf("newHub: %v", err)
+	}
+	room, _ := h.createRoom("bench", "", false, 0, false, "")
+	for i := range 500 {
+		env := newEnvelope(protocol.EventChat, room, fmt.Sprintf("message %d: the quick brown fox jumps over the lazy dog", i))
+		env.Sender = "sender"
+		h.sequence(room, &env)
+	}
+
+	b.Run("frames", func(b *testing.B) {
+		var frames, size int
+		for b.Loop() {
+			replayed := room.replay.since(0)
+			frames, size = len(replayed), 0
+			for _, data := range replayed {
+				size += len(data)
+			}
+		}
+		b.ReportMetric(float64(frames), "frames/join")
+		b.ReportMetric(float64(size), "first-render-B")
+	})
+	b.Run("windowed", func(b *testing.B) {
+		var size int
+		for b.Loop() {
+			size = len(historyEnvelope(room, 0, room.seq+1).Encode())
+		}
+		b.ReportMetric(1, "frames/join")
+		b.ReportMetric(float64(size), "first-render-B")
+	})
+}
+
+// TestReplayFitsSendBuffer queues a replay at the smallest -send-buffer
+// validate allows, to a member whose frames nothing writes out: the hello,
+// the topic and every buffered message must fit without the member being
+// dropped as a slow consumer. Presence is held back, as it is between
+// flushes, since the frames after the join are the write pump's to drain.
+func TestReplayFitsSendBuffer(t *testing.T) {
+	const replay = 20
+	opts := DefaultOptions()
+	opts.ReplayBuffer, opts.SendBuffer = replay, replay+joinFrames-1
+	if err := opts.validate(); err == nil {
+		t.Fatalf("validate accepts -send-buffer %d for -replay-buffer %d", opts.SendBuffer, opts.ReplayBuffer)
+	}
+
+	s := newTestServer(t, func(o *Options) {
+		withHistory(o)
+		o.ReplayBuffer, o.SendBuffer = replay, replay+joinFrames
+		o.PresenceFlush = time.Minute
+	})
+	s.join(t, "room=lobby&action=create&username=owner&topic=history")
+	s.fillHistory(t, "lobby", replay)
+
+	room := s.getRoom("lobby")
+	late := &Client{
+		session: &session{
+			id:      s.nextClientID.Add(1),
+			conn:    &websocket.Conn{},
+			send:    make(chan []byte, s.opts.SendBuffer),
+			quit:    make(chan struct{}),
+			release: func() {},
+		},
+		room:   room,
+		replay: true,
+	}
+	late.attach(late)
+	if !room.reserve(late, "late") {
+		t.Fatal("room refused the member")
+	}
+	s.register <- late
+	waitFor(t, "the join to be queued", func() bool { return len(late.send) == cap(late.send) || late.slow.Load() })
+	if late.slow.Load() {
+		t.Fatalf("dropped as a slow consumer with %d of %d frames queued", len(late.send), cap(late.send))
+	}
+	if got := len(late.send); got != replay+joinFrames {
+		t.Fatalf("queued %d frames, want %d", got, replay+joinFrames)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type reservation struct {
+	tokenHash [sha256.Size]byte
+	until     time.Time
+	ip        string
+	expiry    *janitorEntry
+}
+
+type reservationStore struct {
+	mu       sync.Mutex
+	janitor  *janitor
+	maxPerIP int
+	byName   map[string]*reservation
+	perIP    map[string]int
+}
+
+func newReservationStore(j *janitor, maxPerIP int) *reservationStore {
+	return &reservationStore{janitor: j, maxPerIP: maxPerIP, byName: make(map[string]*reservation), perIP: make(map[string]int)}
+}
+
+// drop removes a reservation. The caller must hold s.mu.
+func (s *reservationStore) drop(name string, res *reservation) {
+	if s.byName[name] != res {
+		return
+	}
+	delete(s.byName, name)
+	if s.perIP[res.ip]--; s.perIP[res.ip] <= 0 {
+		delete(s.perIP, res.ip)
+	}
+}
+
+func (s *reservationStore) reserve(name, ip string, until time.Time) (string, *joinError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byName[name]; ok {
+		return "", &joinError{http.StatusConflict, "room_reserved", "Room name is already reserved"}
+	}
+	if s.perIP[ip] >= s.maxPerIP {
+		return "", &joinError{http.StatusTooManyRequests, "too_many_reservations", "Too many active reservations"}
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", &joinError{http.StatusInternalServerError, "internal", "Failed to generate token"}
+	}
+	token := hex.EncodeToString(raw)
+	res := &reservation{tokenHash: sha256.Sum256([]byte(token)), until: until, ip: ip}
+	res.expiry = s.janitor.schedule("reservation", time.Until(until), func() {
+		s.mu.Lock()
+		s.drop(name, res)
+		s.mu.Unlock()
+	})
+	s.byName[name] = res
+	s.perIP[ip]++
+	return token, nil
+}
+
+// check reports whether name may be created with the given token.
+func (s *reservationStore) check(name, token string) *joinError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.byName[name]
+	if !ok {
+		return nil
+	}
+	hash := sha256.Sum256([]byte(token))
+	if token == "" || subtle.ConstantTimeCompare(hash[:], res.tokenHash[:]) != 1 {
+		return &joinError{http.StatusForbidden, "room_reserved", "Room name is reserved until " + res.until.UTC().Format(time.RFC3339)}
+	}
+	return nil
+}
+
+// redeem ends the reservation for name, once the room has been created after
+// check, and reports whether there was one.
+func (s *reservationStore) redeem(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.byName[name]
+	if ok {
+		s.janitor.cancel(res.expiry)
+		s.drop(name, res)
+	}
+	return ok
+}
+
+type reserveRequest struct {
+	Name  string    `json:"name"`
+	Until time.Time `json:"until"`
+}
+
+type reserveResponse struct {
+	Name  string    `json:"name"`
+	Token string    `json:"token"`
+	Until time.Time `json:"until"`
+}
+
+func (h *Hub) handleReserve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.checkRoomsToken(w, r) {
+		return
+	}
+
+	var req reserveRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	now := time.Now()
+	switch {
+	case req.Name == "":
+		http.Error(w, "Room name is required", http.StatusBadRequest)
+		return
+	case !req.Until.After(now):
+		http.Error(w, "until must be in the future", http.StatusBadRequest)
+		return
+	case req.Until.Sub(now) > h.opts.MaxReservation:
+		http.Error(w, "Reservation window is too long", http.StatusBadRequest)
+		return
+	}
+	if h.getRoom(req.Name) != nil {
+		http.Error(w, "Room already exists", http.StatusConflict)
+		return
+	}
+
+	resToken, jerr := h.reservations.reserve(req.Name, clientIP(r), req.Until)
+	if jerr != nil {
+		jerr.write(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reserveResponse{Name: req.Name, Token: resToken, Until: req.Until})
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postReserve reserves name for an hour and returns the reservation token.
+func (s *testServer) postReserve(t *testing.T, name string) string {
+	t.Helper()
+	body := `{"name":"` + name + `","until":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`
+	resp, err := http.Post(s.srv.URL+"/rooms/reserve?token="+url.QueryEscape(testRoomsToken), "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var res reserveResponse
+	json.NewDecoder(resp.Body).Decode(&res)
+	if resp.StatusCode != http.StatusCreated || res.Token == "" {
+		t.Fatalf("reserve %s: status %d token %q, want 201 and a token", name, resp.StatusCode, res.Token)
+	}
+	return res.Token
+}
+
+func TestReservationRedeemerOwnsRoom(t *testing.T) {
+	s := newTestServer(t, withRoomsToken)
+	token := s.postReserve(t, "quiz-night")
+	if status := s.dialStatus(t, "room=quiz-night&username=squatter"); status != http.StatusForbidden {
+		t.Fatalf("join without the reservation: status %d, want 403", status)
+	}
+
+	host, _ := s.join(t, "room=quiz-night&username=host&reservation="+token)
+	host.send("/invite")
+	host.nextSystem("Single-use invite")
+
+	guest, _ := s.join(t, "room=quiz-night&username=guest")
+	guest.send("/invite")
+	guest.nextSystem("Only the room owner")
+}
+
+func TestJoinCreatingRoomDoesNotOwnIt(t *testing.T) {
+	s := newTestServer(t, nil)
+	first, _ := s.join(t, "room=open&username=first")
+	first.send("/invite")
+	first.nextSystem("Only the room owner")
+}
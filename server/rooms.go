@@ -0,0 +1,86 @@
+package server
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const roomShardCount = 64
+
+type roomShard struct {
+	mu    sync.RWMutex
+	rooms map[string]*Room
+}
+
+// roomMap spreads rooms over independently locked shards keyed by a hash of
+// the name, so lookups for different rooms rarely contend.
+type roomMap struct {
+	shards [roomShardCount]roomShard
+}
+
+func newRoomMap() *roomMap {
+	m := &roomMap{}
+	for i := range m.shards {
+		m.shards[i].rooms = make(map[string]*Room)
+	}
+	return m
+}
+
+func (m *roomMap) shard(name string) *roomShard {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return &m.shards[h.Sum32()%roomShardCount]
+}
+
+func (m *roomMap) get(name string) *Room {
+	s := m.shard(name)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rooms[name]
+}
+
+// insert adds room under its name unless the name is taken. The check and the
+// insert happen under one shard lock, so of two concurrent creates exactly
+// one wins.
+func (m *roomMap) insert(room *Room) bool {
+	s := m.shard(room.name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[room.name]; ok {
+		return false
+	}
+	s.rooms[room.name] = room
+	return true
+}
+
+// removeIf deletes the named room if remove, called with the room locked,
+// agrees, and reports whether it did. Holding the shard lock meanwhile keeps a concurrent insert of the
+// same name from slipping in between the check and the delete.
+func (m *roomMap) removeIf(name string, remove func(*Room) bool) bool {
+	s := m.shard(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room, ok := s.rooms[name]
+	if !ok {
+		return false
+	}
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if !remove(room) {
+		return false
+	}
+	delete(s.rooms, name)
+	return true
+}
+
+// each calls fn for every room, holding one shard's read lock at a time.
+func (m *roomMap) each(fn func(*Room)) {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for _, room := range s.rooms {
+			fn(room)
+		}
+		s.mu.RUnlock()
+	}
+}
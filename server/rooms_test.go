@@ -0,0 +1,175 @@
+package server
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCreateSameRoomInParallel(t *testing.T) {
+	h, err := NewHub(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := h.createRoom("contested", "", false, 0, false, ""); ok {
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins.Load() != 1 {
+		t.Fatalf("%d creates of one name succeeded, want 1", wins.Load())
+	}
+}
+
+func TestCreateAndRemoveRace(t *testing.T) {
+	h, err := NewHub(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const names = 8
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				name := fmt.Sprintf("room%d", (w+i)%names)
+				if w%2 == 0 {
+					h.createRoom(name, "", false, 0, false, "")
+				} else {
+					h.removeRoom(name)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for i := range names {
+		name := fmt.Sprintf("room%d", i)
+		existed := h.getRoom(name) != nil
+		if _, created := h.createRoom(name, "", false, 0, false, ""); created == existed {
+			t.Fatalf("%s: create and lookup disagree", name)
+		}
+	}
+}
+
+func TestRemoveKeepsOccupiedRoom(t *testing.T) {
+	h, err := NewHub(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, _ := h.createRoom("occupied", "", false, 0, false, "")
+	c := &Client{session: &session{}, room: room}
+	room.clients[c.conn] = c
+	h.removeRoom("occupied")
+	if h.getRoom("occupied") != room {
+		t.Fatal("removeRoom dropped a room with a member")
+	}
+}
+
+// lockedRoomMap is the single-lock map roomMap replaced, kept to compare
+// against.
+type lockedRoomMap struct {
+	mu    sync.RWMutex
+	rooms map[string]*Room
+}
+
+func (m *lockedRoomMap) get(name string) *Room {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.rooms[name]
+}
+
+func (m *lockedRoomMap) insert(room *Room) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.rooms[room.name]; ok {
+		return false
+	}
+	m.rooms[room.name] = room
+	return true
+}
+
+func (m *lockedRoomMap) removeIf(name string, remove func(*Room) bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room, ok := m.rooms[name]
+	if !ok || !remove(room) {
+		return false
+	}
+	delete(m.rooms, name)
+	return true
+}
+
+type roomIndex interface {
+	get(string) *Room
+	insert(*Room) bool
+	removeIf(string, func(*Room) bool) bool
+}
+
+// BenchmarkRoomLookup runs lookups mixed with creates and removes, one in
+// twenty each, across 50,000 rooms from every CPU.
+func BenchmarkRoomLookup(b *testing.B) {
+	const rooms = 50000
+	names := make([]string, rooms)
+	for i := range names {
+		names[i] = fmt.Sprintf("room-%d", i)
+	}
+	for _, bench := range []struct {
+		name string
+		m    roomIndex
+	}{
+		{"sharded", newRoomMap()},
+		{"single-lock", &lockedRoomMap{rooms: make(map[string]*Room)}},
+	} {
+		for _, name := range names {
+			bench.m.insert(&Room{name: name})
+		}
+		b.Run(bench.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewPCG(rand.Uint64(), 0))
+				for pb.Next() {
+					name := names[r.IntN(rooms)]
+					switch n := r.IntN(20); {
+					case n == 0:
+						bench.m.insert(&Room{name: name})
+					case n == 1:
+						bench.m.removeIf(name, func(*Room) bool { return true })
+					default:
+						bench.m.get(name)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestConcurrentJoinsCreateOneRoom(t *testing.T) {
+	s := newTestServer(t, nil)
+	const joins = 20
+	var wg sync.WaitGroup
+	for i := range joins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, _, err := websocket.DefaultDialer.Dial(s.wsURL(fmt.Sprintf("room=race&username=racer%d", i)), nil)
+			if err != nil {
+				t.Errorf("join %d: %v", i, err)
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}()
+	}
+	wg.Wait()
+	waitFor(t, "every join to register", func() bool { return s.memberCount("race") == joins })
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"chat/protocol"
+)
+
+// roster lists the room's members by name. The caller must hold r.mu.
+func (r *Room) roster() []protocol.Member {
+	members := make([]protocol.Member, 0, len(r.clients))
+	for _, client := range r.clients {
+		members = append(members, protocol.Member{Name: client.nick(), ID: client.publicID})
+	}
+	slices.SortFunc(members, func(a, b protocol.Member) int { return strings.Compare(foldName(a.Name), foldName(b.Name)) })
+	return members
+}
+
+func (h *Hub) handleRoomUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !h.checkRoomsToken(w, r) {
+		return
+	}
+	room := h.getRoom(r.PathValue("name"))
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	room.mu.RLock()
+	private := room.private
+	members := room.roster()
+	room.mu.RUnlock()
+	if private {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]protocol.Member{"users": members})
+}
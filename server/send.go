@@ -0,0 +1,128 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat/protocol"
+)
+
+const defaultSenderName = "bot"
+
+type sendRequest struct {
+	Room     string `json:"room"`
+	Username string `json:"username"`
+	Text     string `json:"text"`
+	Password string `json:"password"`
+}
+
+// handleSend serves POST /rooms/send, which posts a chat message into a room
+// for senders that do not hold a socket open. The room's password, or the
+// rooms token as a bearer, admits the request; the message then goes through
+// the hub like any other. Rejoin codes are for rejoining, once, and do not
+// admit a sender.
+func (h *Hub) handleSend(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := clientIP(r)
+	if h.attempts.blocked(ip) {
+		http.Error(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	var req sendRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(h.opts.MaxMessageSize)+4096)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	text := sanitizeText(req.Text)
+	name, jerr := h.joinUsername(strings.TrimSpace(sanitizeText(req.Username)))
+	if jerr != nil {
+		jerr.write(w)
+		return
+	}
+	if name == "" {
+		name = defaultSenderName
+	}
+	switch {
+	case strings.TrimSpace(text) == "":
+		http.Error(w, "text is required", http.StatusBadRequest)
+		return
+	case len(text) > h.opts.MaxMessageSize:
+		http.Error(w, fmt.Sprintf("text is over %d bytes", h.opts.MaxMessageSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	room := h.getRoom(req.Room)
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !h.roomsBearer(r) && !room.checkPassword(req.Password) {
+		h.attempts.fail(ip)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if room.banned(name, ip) {
+		http.Error(w, "You are banned from this room", http.StatusForbidden)
+		return
+	}
+	if !h.allowSender(room, ip, time.Now()) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many messages, slow down", http.StatusTooManyRequests)
+		return
+	}
+
+	env := newEnvelope(protocol.EventChat, room, text)
+	env.Sender = name
+	env.Bot = true
+	h.message <- &Message{room: room, env: &env}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// roomsBearer reports whether r carries the rooms token as a bearer token.
+func (h *Hub) roomsBearer(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && h.opts.RoomsToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.opts.RoomsToken)) == 1
+}
+
+// allowSender applies the limits a socket in room would see to an HTTP
+// sender: a bucket per IP under the room's rate profile, then the room's
+// shared bucket. An IP's bucket is forgotten a minute after it is made, by
+// which time it would have refilled under any of the named profiles.
+func (h *Hub) allowSender(room *Room, ip string, now time.Time) bool {
+	profile := room.currentRateProfile()
+	room.mu.Lock()
+	if room.senders == nil {
+		room.senders = make(map[string]*tokenBucket)
+	}
+	bucket := room.senders[ip]
+	if bucket == nil {
+		b := newTokenBucket(profile.Rate, profile.Burst)
+		bucket = &b
+		room.senders[ip] = bucket
+		h.janitor.schedule("http-sender", strikeWindow, func() {
+			room.mu.Lock()
+			delete(room.senders, ip)
+			room.mu.Unlock()
+		})
+	} else if bucket.rate != profile.Rate || bucket.burst != float64(profile.Burst) {
+		bucket.retune(now, profile.Rate, profile.Burst)
+	}
+	ok := bucket.allow(now)
+	room.mu.Unlock()
+	return ok && room.limiter.allow(now)
+}
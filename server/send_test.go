@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"chat/protocol"
+)
+
+func (s *testServer) postSend(t *testing.T, bearer, body string) int {
+	t.Helper()
+	req, _ := http.NewRequest("POST", s.srv.URL+"/rooms/send", strings.NewReader(body))
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSendWithPassword(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner := s.passwordRoom(t, "vault")
+	if status := s.postSend(t, "", `{"room":"vault","text":"hi","password":"wrong"}`); status != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d, want 401", status)
+	}
+	if status := s.postSend(t, "", `{"room":"vault","text":"hi","password":"hunter2"}`); status != http.StatusAccepted {
+		t.Fatalf("password: status %d, want 202", status)
+	}
+	if got := owner.next(protocol.EventChat); got.Body != "hi" || got.Sender != defaultSenderName || !got.Bot {
+		t.Fatalf("chat = %+v", got)
+	}
+	if status := s.postSend(t, "", `{"room":"nowhere","text":"hi"}`); status != http.StatusNotFound {
+		t.Fatalf("missing room: status %d, want 404", status)
+	}
+}
+
+func TestSendWithRoomsToken(t *testing.T) {
+	s := newTestServer(t, withRoomsToken)
+	s.passwordRoom(t, "vault")
+	if status := s.postSend(t, testRoomsToken, `{"room":"vault","text":"hi"}`); status != http.StatusAccepted {
+		t.Fatalf("rooms token: status %d, want 202", status)
+	}
+}
+
+func TestSendRefusesRejoinCode(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner, _ := s.join(t, "action=create&room=club&username=owner")
+	member, _ := s.join(t, "room=club&username=member")
+	owner.send("/private hunter2")
+	notice := member.nextSystem("one-time code: ")
+	code := strings.Fields(strings.SplitN(notice.Body, "one-time code: ", 2)[1])[0]
+
+	if status := s.postSend(t, "", `{"room":"club","text":"hi","password":"`+code+`"}`); status != http.StatusUnauthorized {
+		t.Fatalf("rejoin code: status %d, want 401", status)
+	}
+	// The code is still good for the rejoin it was handed out for.
+	s.join(t, "room=club&username=member&password="+code)
+	if status := s.dialStatus(t, "room=club&username=member&password="+code); status != http.StatusUnauthorized {
+		t.Fatalf("spent rejoin code: status %d, want 401", status)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Drain refuses new connections, tells every room the server is going away
+// and closes each client with CloseGoingAway, then waits until the
+// connection goroutines have finished flushing or ctx expires. Rooms are
+// kept while draining, and with -persist saved one last time at the end,
+// with their members' reminders, so the shutdown itself does not lose them. Run must still be running, since
+// read loops hand their unregister to it.
+func (h *Hub) Drain(ctx context.Context) {
+	h.draining.Store(true)
+	var rooms []*Room
+	h.rooms.each(func(room *Room) { rooms = append(rooms, room) })
+	if h.store != nil {
+		for _, room := range rooms {
+			h.holdReminders(room)
+		}
+	}
+	for _, room := range rooms {
+		h.closeRoom(room, "The server is shutting down.", "server shutting down")
+	}
+	if h.store != nil {
+		defer h.saveRooms()
+	}
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for h.connGoroutines() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *Hub) connGoroutines() int {
+	total := 0
+	for reason, n := range h.lifecycle.snapshot() {
+		if strings.HasPrefix(reason, connReasonPrefix) {
+			total += n
+		}
+	}
+	return total
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// layeredFS opens a name from the first layer that has it.
+type layeredFS []fs.FS
+
+func (l layeredFS) Open(name string) (fs.File, error) {
+	for _, layer := range l {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (h *Hub) frontendFS() fs.FS {
+	var layers layeredFS
+	if h.opts.StaticDir != "" {
+		layers = append(layers, os.DirFS(h.opts.StaticDir))
+	}
+	if h.opts.Frontend != nil {
+		layers = append(layers, h.opts.Frontend)
+	}
+	if len(layers) == 0 {
+		layers = append(layers, os.DirFS("./build"))
+	}
+	return layers
+}
+
+type frontendHandler struct {
+	fsys fs.FS
+}
+
+func newFrontendHandler(fsys fs.FS) *frontendHandler {
+	return &frontendHandler{fsys: fsys}
+}
+
+func (h *frontendHandler) isFile(name string) bool {
+	info, err := fs.Stat(h.fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+func (h *frontendHandler) resolve(urlPath string) (string, bool) {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		return "index.html", true
+	}
+	if h.isFile(name) {
+		return name, true
+	}
+	if h.isFile(path.Join(name, "index.html")) {
+		return path.Join(name, "index.html"), true
+	}
+	// Unknown extensionless paths are client-side routes handled by the SPA.
+	if path.Ext(name) == "" {
+		return "index.html", true
+	}
+	return "", false
+}
+
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(token, encoding) && strings.TrimSpace(params) != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *frontendHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name, ok := h.resolve(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h.serveFile(w, r, name)
+}
+
+func (h *frontendHandler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	if strings.HasPrefix(name, "_app/immutable/") {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	served := name
+	for _, variant := range []struct{ suffix, encoding string }{{".br", "br"}, {".gz", "gzip"}} {
+		if acceptsEncoding(r, variant.encoding) && h.isFile(name+variant.suffix) {
+			served = name + variant.suffix
+			w.Header().Set("Content-Encoding", variant.encoding)
+			break
+		}
+	}
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+
+	f, err := h.fsys.Open(served)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		log.Printf("static file %s is not seekable", served)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"chat/protocol"
+)
+
+// maxTopicLength is the longest room topic in characters.
+const maxTopicLength = 120
+
+var topicTooLong = fmt.Sprintf("Topics can be at most %d characters.", maxTopicLength)
+
+// topicCommand lets the owner replace the room's topic and tells everyone.
+func (h *Hub) topicCommand(client *Client, arg string) string {
+	if utf8.RuneCountInString(arg) > maxTopicLength {
+		return topicTooLong
+	}
+	room := client.room
+	room.mu.Lock()
+	room.topic = arg
+	room.mu.Unlock()
+	h.roomsChanged()
+	h.flushPresence(room)
+	h.broadcastToRoom(room, 0, newEnvelope(protocol.EventSystem, room, client.nick()+" set the topic: "+arg).Encode())
+	return ""
+}
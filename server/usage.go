@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	topRoomsInReport  = 10
+	reportWebhookWait = 10 * time.Second
+)
+
+// usageDay holds one day's counters. Nothing in it comes from message
+// contents: messages are only counted, by hour and by public room.
+type usageDay struct {
+	start        time.Time
+	ips          map[string]bool
+	names        map[string]bool
+	peak         int
+	created      uint64
+	removed      uint64
+	byHour       [24]uint64
+	roomMessages map[string]uint64
+	errors       map[string]uint64
+}
+
+func newUsageDay(start time.Time, live int) *usageDay {
+	return &usageDay{
+		start:        start,
+		ips:          make(map[string]bool),
+		names:        make(map[string]bool),
+		peak:         live,
+		roomMessages: make(map[string]uint64),
+		errors:       make(map[string]uint64),
+	}
+}
+
+// usageCounters feeds -daily-report. Every increment and the rollover take
+// the same lock, so each event lands in exactly one day. A nil
+// *usageCounters counts nothing.
+type usageCounters struct {
+	mu   sync.Mutex
+	loc  *time.Location
+	live int
+	day  *usageDay
+}
+
+func newUsageCounters(loc *time.Location) *usageCounters {
+	return &usageCounters{loc: loc, day: newUsageDay(time.Now().In(loc), 0)}
+}
+
+func (u *usageCounters) connected(ip, name string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.live++
+	u.day.peak = max(u.day.peak, u.live)
+	u.day.ips[ip] = true
+	u.day.names[foldName(name)] = true
+}
+
+func (u *usageCounters) disconnected() {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.live--
+	u.mu.Unlock()
+}
+
+func (u *usageCounters) roomCreated() {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.day.created++
+	u.mu.Unlock()
+}
+
+func (u *usageCounters) roomRemoved() {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.day.removed++
+	u.mu.Unlock()
+}
+
+func (u *usageCounters) message(room *Room) {
+	if u == nil {
+		return
+	}
+	room.mu.RLock()
+	public := !room.private
+	room.mu.RUnlock()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.day.byHour[time.Now().In(u.loc).Hour()]++
+	if public {
+		u.day.roomMessages[room.name]++
+	}
+}
+
+// countError counts one failure of class, such as join_invalid_password or
+// slow_consumer.
+func (u *usageCounters) countError(class string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.day.errors[class]++
+	u.mu.Unlock()
+}
+
+// rollover starts a new day at now and returns the one it ends. The old day
+// is no longer reachable from u, so it can be reported without the lock.
+func (u *usageCounters) rollover(now time.Time) *usageDay {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	day := u.day
+	u.day = newUsageDay(now.In(u.loc), u.live)
+	return day
+}
+
+type roomActivity struct {
+	Room     string `json:"room"`
+	Messages uint64 `json:"messages"`
+}
+
+type usageReport struct {
+	From            time.Time         `json:"from"`
+	To              time.Time         `json:"to"`
+	Partial         bool              `json:"partial,omitempty"`
+	UniqueIPs       int               `json:"uniqueIPs"`
+	UniqueNames     int               `json:"uniqueNames"`
+	PeakConnections int               `json:"peakConnections"`
+	RoomsCreated    uint64            `json:"roomsCreated"`
+	RoomsRemoved    uint64            `json:"roomsRemoved"`
+	MessagesByHour  [24]uint64        `json:"messagesByHour"`
+	TopRooms        []roomActivity    `json:"topRooms"`
+	Errors          map[string]uint64 `json:"errors"`
+}
+
+func (d *usageDay) report(end time.Time) usageReport {
+	top := make([]roomActivity, 0, len(d.roomMessages))
+	for name, n := range d.roomMessages {
+		top = append(top, roomActivity{name, n})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Messages != top[j].Messages {
+			return top[i].Messages > top[j].Messages
+		}
+		return top[i].Room < top[j].Room
+	})
+	if len(top) > topRoomsInReport {
+		top = top[:topRoomsInReport]
+	}
+	errors := make(map[string]uint64, len(d.errors))
+	for class, n := range d.errors {
+		errors[class] = n
+	}
+	return usageReport{
+		From:            d.start,
+		To:              end.In(d.start.Location()),
+		UniqueIPs:       len(d.ips),
+		UniqueNames:     len(d.names),
+		PeakConnections: d.peak,
+		RoomsCreated:    d.created,
+		RoomsRemoved:    d.removed,
+		MessagesByHour:  d.byHour,
+		TopRooms:        top,
+		Errors:          errors,
+	}
+}
+
+// partialReport covers the day so far without ending it.
+func (u *usageCounters) partialReport() usageReport {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	r := u.day.report(time.Now())
+	r.Partial = true
+	return r
+}
+
+// scheduleDailyReport ends the day at the next midnight in the report time
+// zone. The report is written on its own goroutine so neither the janitor nor
+// the hub waits for the disk or the webhook.
+func (h *Hub) scheduleDailyReport() {
+	now := time.Now().In(h.usage.loc)
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d+1, 0, 0, 0, 0, h.usage.loc)
+	h.janitor.schedule("daily-report", time.Until(midnight), func() {
+		day := h.usage.rollover(midnight)
+		h.spawn("hub.report", func() { h.publishReport(day.report(midnight)) })
+		h.scheduleDailyReport()
+	})
+}
+
+func (h *Hub) publishReport(r usageReport) {
+	path := filepath.Join(h.opts.DailyReport, "usage-"+r.From.Format(time.DateOnly)+".json")
+	if err := writeFileAtomic(path, r); err != nil {
+		log.Printf("Failed to write usage report %s: %v", path, err)
+	} else {
+		log.Printf("Wrote usage report %s", path)
+	}
+	if h.opts.DailyReportWebhook == "" {
+		return
+	}
+	body, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("Failed to encode usage report: %v", err)
+		return
+	}
+	client := http.Client{Timeout: reportWebhookWait}
+	resp, err := client.Post(h.opts.DailyReportWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to post usage report: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Usage report webhook answered %s", resp.Status)
+	}
+}
+
+// handleReport serves the report for the day so far; the day keeps going.
+func (h *Hub) handleReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.usage.partialReport())
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// guestName matches the names the server hands out to guests, which nobody
+// may pick for themselves.
+var guestName = regexp.MustCompile(`(?i)^guest[0-9]+$`)
+
+// reservedNames are names clients could mistake for the server.
+var reservedNames = map[string]bool{"sys": true, "system": true, "server": true}
+
+// usernameProblem says what is wrong with a name a client chose, or returns
+// "" if nothing is. Names arrive trimmed and with control characters removed.
+func (o *Options) usernameProblem(name string) string {
+	if n := utf8.RuneCountInString(name); n > o.MaxUsernameLength {
+		return fmt.Sprintf("Names can be at most %d characters.", o.MaxUsernameLength)
+	}
+	for _, r := range name {
+		if unicode.IsSpace(r) {
+			return "Names cannot contain spaces."
+		}
+		if !unicode.IsPrint(r) {
+			return "Names can only contain printable characters."
+		}
+	}
+	if reservedNames[foldName(name)] || guestName.MatchString(name) {
+		return "That name is reserved."
+	}
+	return ""
+}
+
+// joinUsername is the name a join goes ahead with: the chosen one, or "" for
+// a generated guest name when the choice is invalid and -lenient-usernames
+// is set. Without it an invalid name refuses the join.
+func (h *Hub) joinUsername(name string) (string, *joinError) {
+	if name == "" {
+		return "", nil
+	}
+	problem := h.opts.usernameProblem(name)
+	switch {
+	case problem == "":
+		return name, nil
+	case h.opts.LenientUsernames:
+		return "", nil
+	}
+	return "", &joinError{http.StatusBadRequest, "invalid_username", problem}
+}
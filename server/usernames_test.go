@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUsernameProblem(t *testing.T) {
+	opts := DefaultOptions()
+	for name, ok := range map[string]bool{
+		"alice":                 true,
+		"Zoë":                   true,
+		"guest":                 true,
+		"guestbook":             true,
+		strings.Repeat("a", 32): true,
+		strings.Repeat("é", 32): true,
+		strings.Repeat("a", 33): false,
+		"two words":             false,
+		"tab\there":             false,
+		"bell\a":                false,
+		"SYS":                   false,
+		"System":                false,
+		"server":                false,
+		"Guest0042":             false,
+		"guest7":                false,
+		"zero\u200bwidth":       false,
+	} {
+		if got := opts.usernameProblem(name) == ""; got != ok {
+			t.Errorf("usernameProblem(%q) = %q", name, opts.usernameProblem(name))
+		}
+	}
+	opts.MaxUsernameLength = 5
+	if opts.usernameProblem("abcdef") == "" {
+		t.Error("-max-username-length not applied")
+	}
+}
+
+func TestJoinUsername(t *testing.T) {
+	h, err := NewHub(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, jerr := h.joinUsername("alice"); name != "alice" || jerr != nil {
+		t.Fatalf("joinUsername(alice) = %q, %v", name, jerr)
+	}
+	if name, jerr := h.joinUsername(""); name != "" || jerr != nil {
+		t.Fatalf("joinUsername(\"\") = %q, %v; want a guest name", name, jerr)
+	}
+	if _, jerr := h.joinUsername("SYS"); jerr == nil || jerr.Status != http.StatusBadRequest {
+		t.Fatalf("joinUsername(SYS) error = %v, want 400", jerr)
+	}
+
+	opts := DefaultOptions()
+	opts.LenientUsernames = true
+	h, _ = NewHub(opts)
+	if name, jerr := h.joinUsername("SYS"); name != "" || jerr != nil {
+		t.Fatalf("lenient joinUsername(SYS) = %q, %v; want a guest name", name, jerr)
+	}
+}
+
+func TestJoinWithInvalidName(t *testing.T) {
+	s := newTestServer(t, nil)
+	if status := s.dialStatus(t, "room=lobby&username=Guest12"); status != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", status)
+	}
+	// Names are trimmed before they are checked.
+	if _, hello := s.join(t, "room=lobby&username=%20alice%20"); hello.Sender != "alice" {
+		t.Fatalf("hello = %+v", hello)
+	}
+
+	s = newTestServer(t, func(o *Options) { o.LenientUsernames = true })
+	if _, hello := s.join(t, "room=lobby&username=Guest12"); !guestName.MatchString(hello.Sender) || hello.Sender == "Guest12" {
+		t.Fatalf("lenient join named %q, want a generated guest name", hello.Sender)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"chat/protocol"
+)
+
+// whoamiCommand is /whoami, the typed form of a whoami frame.
+func (h *Hub) whoamiCommand(client *Client, arg string) string {
+	h.sendWhoami(client)
+	return ""
+}
+
+// sendWhoami tells client what the server knows about it. It runs on the
+// client's read loop, the only goroutine that touches client.limiter and
+// client.sent, and holds the room's read lock only to copy the roles, name
+// and profile.
+func (h *Hub) sendWhoami(client *Client) {
+	room := client.room
+	room.mu.RLock()
+	var roles []string
+	if room.ownerID != "" && room.ownerID == client.publicID {
+		roles = append(roles, "owner")
+	}
+	if room.operators[client.publicID] {
+		roles = append(roles, "operator")
+	}
+	name := client.nick()
+	profile := room.rateProfile
+	room.mu.RUnlock()
+
+	now := time.Now()
+	self := &protocol.Whoami{
+		Name:         name,
+		ID:           client.publicID,
+		ConnectionID: client.connID,
+		Rooms:        client.roomNames(),
+		Roles:        roles,
+		ConnectedAt:  client.connectedAt.UTC(),
+		MessagesSent: client.sent,
+		Limits:       *profile.limits(),
+		Available:    client.limiter.available(now),
+		Strikes:      client.limiter.currentStrikes(now),
+		Echo:         client.echo,
+	}
+	role := "member"
+	if len(roles) > 0 {
+		role = strings.Join(roles, ", ")
+	}
+	body := fmt.Sprintf("You are %s (id %s), %s of %s, connected %s ago; %d messages sent, %d of %d more allowed right now.",
+		name, client.publicID, role, room.name, now.Sub(client.connectedAt).Round(time.Second), client.sent, self.Available, profile.Burst)
+	env := newEnvelope(protocol.EventWhoami, room, body)
+	env.Whoami = self
+	h.sendTo(client, env.Encode())
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"chat/protocol"
+)
+
+// TestWhoamiFields checks a two-room connection's whoami for each room
+// against the state it is built from.
+func TestWhoamiFields(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.join(t, "room=lobby&username=bob")
+	alice, hello := s.join(t, "action=create&room=den&username=alice")
+	alice.sendFrame(protocol.Inbound{Type: protocol.TypeJoin, Room: "lobby"})
+	waitFor(t, "alice to join lobby", func() bool { return s.memberCount("lobby") == 2 })
+
+	for _, tc := range []struct {
+		room  string
+		roles []string
+	}{
+		{"den", []string{"owner"}},
+		{"lobby", nil},
+	} {
+		alice.sendFrame(protocol.Inbound{Type: protocol.TypeWhoami, Room: tc.room})
+		env := alice.next(protocol.EventWhoami)
+		got := env.Whoami
+		if env.Room != tc.room || got == nil {
+			t.Fatalf("whoami for %s came as %+v", tc.room, env)
+		}
+		room := s.getRoom(tc.room)
+		member := room.lookupName("alice")
+		room.mu.RLock()
+		limits := *room.rateProfile.limits()
+		room.mu.RUnlock()
+		if got.Name != member.nick() || got.ID != member.publicID {
+			t.Errorf("%s: name %q id %q, want %q %q", tc.room, got.Name, got.ID, member.nick(), member.publicID)
+		}
+		if got.ConnectionID != hello.ConnectionID {
+			t.Errorf("%s: connection id %q, want %q from hello", tc.room, got.ConnectionID, hello.ConnectionID)
+		}
+		if want := []string{"den", "lobby"}; !reflect.DeepEqual(got.Rooms, want) {
+			t.Errorf("%s: rooms %v, want %v", tc.room, got.Rooms, want)
+		}
+		if !reflect.DeepEqual(got.Roles, tc.roles) {
+			t.Errorf("%s: roles %v, want %v", tc.room, got.Roles, tc.roles)
+		}
+		if got.Limits != limits {
+			t.Errorf("%s: limits %+v, want the room's %+v", tc.room, got.Limits, limits)
+		}
+		if got.MessagesSent != 0 || got.Available > limits.MessageBurst {
+			t.Errorf("%s: %d sent, %d available, want none sent and at most %d available", tc.room, got.MessagesSent, got.Available, limits.MessageBurst)
+		}
+	}
+}
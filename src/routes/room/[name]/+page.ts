@@ -0,0 +1,8 @@
+import { redirect } from '@sveltejs/kit';
+import type { PageLoad } from './$types';
+
+export const prerender = false;
+
+export const load: PageLoad = ({ params }) => {
+	redirect(307, `/?room=${encodeURIComponent(params.name)}`);
+};